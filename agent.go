@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+// The agent keeps connections to services open between invocations.
+// A client connects to the agent socket and sends the service address
+// terminated by a NUL byte. The agent answers with a NUL terminated
+// status, empty on success or the connection error otherwise, after
+// which the client speaks plain varlink. The agent forwards the calls
+// over a pooled connection to that address and hands the connection
+// back to the pool once the client is done with it.
+//
+// Client and agent only talk to processes of the same user, as told by
+// SO_PEERCRED, so the agent is not available elsewhere.
+//
+// The varlink library cannot take the agent connection as it is, so the
+// client relays it through a private unix socket, see connectConn. That
+// costs more than connecting to a local service directly, about 0.2ms
+// against 0.05ms per call in BenchmarkCallAgent and BenchmarkCallDirect,
+// so the agent only pays off for services that are slow to connect to.
+
+const agentStop = "stop"
+
+var agentSocket string
+
+// defaultAgentSocket is in the runtime directory or, without one, in a
+// directory of our own in the temporary directory, which runAgent
+// creates.
+func defaultAgentSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "varlink-cmd-agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("varlink-cmd-%d", os.Getuid()), "agent.sock")
+}
+
+// ownUser reports whether the peer of the unix socket connection c is
+// running as our user.
+func ownUser(c net.Conn) bool {
+	uid, ok := peerUID(c)
+	return ok && uid == os.Getuid()
+}
+
+// agentConnect returns a connection to address through the agent, or
+// nil if no agent is listening. The agent is not used with -keepalive,
+// -trace, -debug-frames or -debug, which need a connection of our own.
+func agentConnect(ctx context.Context, address string) *varlink.Connection {
+	if agentSocket == "" || keepAlive != 0 || tracing || debugFrames || debug {
+		return nil
+	}
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "unix", agentSocket)
+	if err != nil {
+		return nil
+	}
+	if !ownUser(c) {
+		c.Close()
+		return nil
+	}
+
+	if _, err := c.Write(append([]byte(address), 0)); err != nil {
+		c.Close()
+		return nil
+	}
+
+	// Read the status byte by byte, nothing beyond it may be consumed.
+	status := make([]byte, 0, 64)
+	b := make([]byte, 1)
+	for {
+		if _, err := c.Read(b); err != nil {
+			c.Close()
+			return nil
+		}
+		if b[0] == 0 {
+			break
+		}
+		status = append(status, b[0])
+	}
+	if len(status) != 0 {
+		// Let the caller connect directly and report the error itself.
+		c.Close()
+		return nil
+	}
+
+	con, err := connectConn(ctx, c)
+	if err != nil {
+		c.Close()
+		return nil
+	}
+	return con
+}
+
+type agent struct {
+	std  *streams
+	mu   sync.Mutex
+	idle map[string][]net.Conn
+	stop chan struct{}
+}
+
+func (a *agent) get(ctx context.Context, address string) (net.Conn, bool, error) {
+	a.mu.Lock()
+	if conns := a.idle[address]; len(conns) > 0 {
+		c := conns[len(conns)-1]
+		a.idle[address] = conns[:len(conns)-1]
+		a.mu.Unlock()
+		return c, true, nil
+	}
+	a.mu.Unlock()
+
+	words := strings.SplitN(address, ":", 2)
+	if len(words) != 2 {
+		return nil, false, errors.New("protocol missing")
+	}
+	addr := strings.SplitN(words[1], ";", 2)[0]
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, words[0], addr)
+	return c, false, err
+}
+
+func (a *agent) put(address string, c net.Conn) {
+	a.mu.Lock()
+	a.idle[address] = append(a.idle[address], c)
+	a.mu.Unlock()
+}
+
+// serve forwards the calls of one client. The service connection is
+// only returned to the pool if the client disconnected between calls.
+func (a *agent) serve(ctx context.Context, client net.Conn) {
+	defer client.Close()
+
+	if !ownUser(client) {
+		if debug {
+			fmt.Fprintf(a.std.err, "agent: refusing client of another user\n")
+		}
+		return
+	}
+
+	cr := bufio.NewReader(client)
+	header, err := cr.ReadString(0)
+	if err != nil {
+		return
+	}
+	address := strings.TrimSuffix(header, "\x00")
+
+	if address == agentStop {
+		close(a.stop)
+		return
+	}
+
+	service, pooled, err := a.get(ctx, address)
+	if err != nil {
+		if debug {
+			fmt.Fprintf(a.std.err, "agent: cannot connect to '%s': %v\n", address, err)
+		}
+		_, _ = client.Write(append([]byte(err.Error()), 0))
+		return
+	}
+	if _, err := client.Write([]byte{0}); err != nil {
+		a.put(address, service)
+		return
+	}
+	sr := bufio.NewReader(service)
+	first := true
+
+	for {
+		request, err := cr.ReadBytes(0)
+		if err != nil {
+			if err == io.EOF && len(request) == 0 {
+				a.put(address, service)
+			} else {
+				service.Close()
+			}
+			return
+		}
+
+		var call struct {
+			Oneway  bool `json:"oneway"`
+			Upgrade bool `json:"upgrade"`
+		}
+		_ = json.Unmarshal(request[:len(request)-1], &call)
+
+		_, err = service.Write(request)
+		if err != nil && first && pooled {
+			// The service may have dropped the idle connection.
+			service.Close()
+			service, _, err = a.get(ctx, address)
+			if err == nil {
+				sr = bufio.NewReader(service)
+				_, err = service.Write(request)
+			}
+		}
+		if err != nil {
+			if service != nil {
+				service.Close()
+			}
+			return
+		}
+		first = false
+
+		if call.Upgrade {
+			// The connection no longer speaks varlink, it cannot be reused.
+			go func() { _, _ = io.Copy(service, cr) }()
+			_, _ = io.Copy(client, sr)
+			service.Close()
+			return
+		}
+
+		if call.Oneway {
+			continue
+		}
+
+		for {
+			reply, err := sr.ReadBytes(0)
+			if err != nil {
+				service.Close()
+				return
+			}
+			if _, err := client.Write(reply); err != nil {
+				service.Close()
+				return
+			}
+
+			var r struct {
+				Continues bool `json:"continues"`
+			}
+			_ = json.Unmarshal(reply[:len(reply)-1], &r)
+			if !r.Continues {
+				break
+			}
+		}
+	}
+}
+
+// prepareAgentDir creates the directory of the agent socket if needed
+// and makes sure nobody else can listen on the socket.
+func prepareAgentDir() error {
+	if !peerCredAvailable {
+		return errors.New("the agent needs SO_PEERCRED, which is not available on this system")
+	}
+	dir := filepath.Dir(agentSocket)
+	if err := os.Mkdir(dir, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	if err := checkAgentDir(dir); err != nil {
+		return fmt.Errorf("cannot use '%s' for the agent socket: %v", dir, err)
+	}
+	return nil
+}
+
+func runAgent(ctx context.Context, std *streams) error {
+	if err := prepareAgentDir(); err != nil {
+		return err
+	}
+
+	if c, err := net.Dial("unix", agentSocket); err == nil {
+		c.Close()
+		return fmt.Errorf("an agent is already listening on '%s'", agentSocket)
+	}
+	_ = os.Remove(agentSocket)
+
+	l, err := net.Listen("unix", agentSocket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	a := &agent{
+		std:  std,
+		idle: make(map[string][]net.Conn),
+		stop: make(chan struct{}),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-a.stop:
+		}
+		l.Close()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			select {
+			case <-a.stop:
+				return nil
+			case <-ctx.Done():
+				return nil
+			default:
+				return err
+			}
+		}
+		go a.serve(ctx, c)
+	}
+}
+
+func startAgent() error {
+	if err := prepareAgentDir(); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, "-agent-socket", agentSocket, "agent", "run")
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() { _ = cmd.Wait() }()
+
+	for i := 0; i < 50; i++ {
+		if c, err := net.Dial("unix", agentSocket); err == nil {
+			c.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return errors.New("agent did not start listening")
+}
+
+func stopAgent() error {
+	c, err := net.Dial("unix", agentSocket)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = c.Write(append([]byte(agentStop), 0))
+	return err
+}
+
+// agentOptions are the options of agent.
+type agentOptions struct {
+	help bool
+}
+
+func (o *agentOptions) flagSet() *flag.FlagSet {
+	agentFlags := flag.NewFlagSet("agent", flag.ContinueOnError)
+	agentFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return agentFlags
+}
+
+func varlinkAgent(ctx context.Context, std *streams, args []string) error {
+	var o agentOptions
+	agentFlags := o.flagSet()
+	usage := func() error { return std.usage(agentFlags, "<start|run|stop>") }
+	agentFlags.SetOutput(std.err)
+	agentFlags.Usage = func() {}
+
+	if err := agentFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || agentSocket == "" {
+		return usage()
+	}
+
+	var err error
+	switch agentFlags.Arg(0) {
+	case "start":
+		err = startAgent()
+	case "run":
+		err = runAgent(ctx, std)
+	case "stop":
+		err = stopAgent()
+	default:
+		return usage()
+	}
+
+	if err != nil {
+		return std.fail(exitFailure, "Agent %s failed: %v\n", agentFlags.Arg(0), err)
+	}
+	return nil
+}
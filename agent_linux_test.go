@@ -0,0 +1,154 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+// startTestAgent runs the agent until the test ends.
+func startTestAgent(t testing.TB) {
+	t.Helper()
+
+	s := agentSocket
+	agentSocket = filepath.Join(t.TempDir(), "agent", "agent.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- runAgent(ctx, &streams{in: strings.NewReader(""), out: io.Discard, err: io.Discard})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		agentSocket = s
+	})
+	for i := 0; ; i++ {
+		c, err := net.Dial("unix", agentSocket)
+		if err == nil {
+			c.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgent(t *testing.T) {
+	address := startTestService(t)
+	startTestAgent(t)
+	defer func(v bool) { tracing = v }(tracing)
+	ctx := context.Background()
+
+	if fi, err := os.Stat(filepath.Dir(agentSocket)); err != nil || fi.Mode().Perm() != 0o700 {
+		t.Errorf("agent directory not private: %v %v", fi.Mode(), err)
+	}
+
+	con := agentConnect(ctx, address)
+	if con == nil {
+		t.Fatal("agent not used")
+	}
+	con.Close()
+
+	stdout, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Count", `{"count":2}`)
+	if code != 0 || !strings.Contains(stdout, `"n": 1`) {
+		t.Errorf("call through agent: %d %q %q", code, stdout, stderr)
+	}
+
+	tracing = true
+	if con := agentConnect(ctx, address); con != nil {
+		con.Close()
+		t.Error("agent used with -trace")
+	}
+}
+
+func TestCheckAgentDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAgentDir(dir); err != nil {
+		t.Error(err)
+	}
+
+	if err := os.Chmod(dir, 0o1777); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAgentDir(dir); err == nil {
+		t.Error("directory writable by others accepted")
+	}
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAgentDir(link); err == nil {
+		t.Error("symlink accepted")
+	}
+}
+
+// benchmarkCalls connects to address with open and calls Echo, over and
+// over, as a script doing many small calls does.
+func benchmarkCalls(b *testing.B, address string, open func(ctx context.Context) (*varlink.Connection, error)) {
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		con, err := open(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var out json.RawMessage
+		if err := con.Call(ctx, "org.example.test.Echo", json.RawMessage(`{"value":{"a":1}}`), &out); err != nil {
+			b.Fatal(err)
+		}
+		con.Close()
+	}
+}
+
+func BenchmarkCallDirect(b *testing.B) {
+	for _, network := range []string{"unix", "tcp"} {
+		b.Run(network, func(b *testing.B) {
+			address := startTestService(b)
+			if network == "tcp" {
+				address = "tcp:127.0.0.1:" + freePort(b)
+				serveTest(b, address)
+			}
+			benchmarkCalls(b, address, func(ctx context.Context) (*varlink.Connection, error) {
+				return varlink.NewConnection(ctx, address)
+			})
+		})
+	}
+}
+
+func BenchmarkCallAgent(b *testing.B) {
+	for _, network := range []string{"unix", "tcp"} {
+		b.Run(network, func(b *testing.B) {
+			address := startTestService(b)
+			if network == "tcp" {
+				address = "tcp:127.0.0.1:" + freePort(b)
+				serveTest(b, address)
+			}
+			startTestAgent(b)
+			benchmarkCalls(b, address, func(ctx context.Context) (*varlink.Connection, error) {
+				con := agentConnect(ctx, address)
+				if con == nil {
+					return nil, errors.New("agent not used")
+				}
+				return con, nil
+			})
+		})
+	}
+}
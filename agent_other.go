@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// checkAgentDir cannot check the owner of dir on this platform.
+func checkAgentDir(dir string) error {
+	return errors.ErrUnsupported
+}
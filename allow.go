@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+)
+
+// allowedInterfaces, if set by -allow-interfaces, are the only
+// interfaces whose methods may be called or whose descriptions may be
+// asked for.
+var allowedInterfaces []string
+
+func parseInterfaceList(s string) []string {
+	var interfaces []string
+	for _, i := range strings.Split(s, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			interfaces = append(interfaces, i)
+		}
+	}
+	return interfaces
+}
+
+// interfaceAllowed reports whether iface may be used.
+func interfaceAllowed(iface string) bool {
+	if allowedInterfaces == nil {
+		return true
+	}
+	for _, i := range allowedInterfaces {
+		if i == iface {
+			return true
+		}
+	}
+	return false
+}
+
+// allowInterface fails if -allow-interfaces does not list iface.
+func allowInterface(std *streams, iface string) error {
+	if !interfaceAllowed(iface) {
+		return std.fail(exitUsage, "Interface '%s' is not allowed by -allow-interfaces\n", iface)
+	}
+	return nil
+}
+
+// allowMethod fails if -allow-interfaces does not list the interface
+// of method.
+func allowMethod(std *streams, method string) error {
+	if allowedInterfaces == nil {
+		return nil
+	}
+	li := strings.LastIndex(method, ".")
+	if li == -1 {
+		return std.fail(exitFailure, "Invalid method name '%s'\n", method)
+	}
+	return allowInterface(std, method[:li])
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	histogramBuckets = 10
+	histogramWidth   = 40
+)
+
+// percentile returns the latency below which p percent of the sorted
+// latencies fall.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i]
+}
+
+// mean returns the average of the latencies.
+func mean(latencies []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	return sum / time.Duration(len(latencies))
+}
+
+// printHistogram prints the sorted latencies as a bar chart of equally
+// wide buckets between the fastest and the slowest call.
+func printHistogram(w io.Writer, sorted []time.Duration) {
+	min := sorted[0]
+	width := (sorted[len(sorted)-1] - min) / histogramBuckets
+	if width == 0 {
+		width = 1
+	}
+
+	var counts [histogramBuckets]int
+	for _, d := range sorted {
+		b := int((d - min) / width)
+		if b >= histogramBuckets {
+			b = histogramBuckets - 1
+		}
+		counts[b]++
+	}
+
+	most := 0
+	for _, c := range counts {
+		if c > most {
+			most = c
+		}
+	}
+
+	bar := color.New(color.FgGreen)
+	for i, c := range counts {
+		from := min + time.Duration(i)*width
+		fmt.Fprintf(w, "%10v - %-10v %6d %s\n",
+			from.Round(time.Microsecond),
+			(from + width).Round(time.Microsecond),
+			c,
+			bar.Sprint(strings.Repeat("#", c*histogramWidth/most)),
+		)
+	}
+}
+
+// benchOptions are the options of bench.
+type benchOptions struct {
+	count       int
+	histogram   bool
+	inputFormat string
+	help        bool
+}
+
+func (o *benchOptions) flagSet() *flag.FlagSet {
+	benchFlags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	benchFlags.IntVar(&o.count, "n", 100, "Number of calls")
+	benchFlags.BoolVar(&o.histogram, "histogram", false, "Print a histogram of the latencies")
+	benchFlags.StringVar(&o.inputFormat, "input-format", "json", "Format of ARGUMENTS [possible values: json, yaml, toml]")
+	benchFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return benchFlags
+}
+
+func varlinkBench(ctx context.Context, std *streams, args []string) error {
+	var err error
+
+	var o benchOptions
+	benchFlags := o.flagSet()
+	usage := func() error { return std.usage(benchFlags, "<[ADDRESS/]INTERFACE.METHOD> [ARGUMENTS]") }
+	benchFlags.SetOutput(std.err)
+	benchFlags.Usage = func() {}
+
+	if err := benchFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || benchFlags.NArg() < 1 || o.count < 1 {
+		return usage()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var address string
+	methodName := benchFlags.Arg(0)
+	if len(bridge) == 0 && !useActivation(methodName) {
+		li := strings.LastIndex(methodName, "/")
+		if li == -1 {
+			return std.fail(exitFailure, "Invalid address '%s'\n", methodName)
+		}
+		address = methodName[:li]
+		methodName = methodName[li+1:]
+	}
+	if err := allowMethod(std, methodName); err != nil {
+		return err
+	}
+
+	var params json.RawMessage
+	if parameters := benchFlags.Arg(1); parameters != "" {
+		params, err = parseParameters(parameters, o.inputFormat)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse parameters: %v\n", err)
+		}
+	}
+
+	con, err := openConnection(ctx, std, address)
+	if err != nil {
+		return err
+	}
+	defer closeConnection(con)
+
+	latencies := make([]time.Duration, o.count)
+	start := time.Now()
+	for i := range latencies {
+		t := time.Now()
+		recv, err := con.Send(ctx, methodName, params, 0)
+		if err == nil {
+			var reply json.RawMessage
+			_, err = recv(ctx, &reply)
+		}
+		if err != nil {
+			if name, ok := varlinkErrorName(err); ok {
+				return std.fail(exitFailure, "Call %d failed with error: %v\n", i+1, errColor(color.FgRed).Sprint(name))
+			}
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Error calling '%s': %v\n", methodName, err)
+		}
+		latencies[i] = time.Since(t)
+	}
+	elapsed := time.Since(start)
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	fmt.Fprintf(std.out, "%s %d calls in %v, %.1f calls/s\n",
+		bold.Sprint("Calls:"), o.count, elapsed.Round(time.Microsecond), float64(o.count)/elapsed.Seconds())
+	fmt.Fprintf(std.out, "%s min %v, avg %v, max %v\n",
+		bold.Sprint("Latency:"),
+		sorted[0].Round(time.Microsecond),
+		mean(latencies).Round(time.Microsecond),
+		sorted[o.count-1].Round(time.Microsecond))
+	fmt.Fprintf(std.out, "%s p50 %v, p90 %v, p99 %v\n",
+		bold.Sprint("Percentiles:"),
+		percentile(sorted, 50).Round(time.Microsecond),
+		percentile(sorted, 90).Round(time.Microsecond),
+		percentile(sorted, 99).Round(time.Microsecond))
+
+	if o.histogram {
+		fmt.Fprintln(std.out)
+		printHistogram(std.out, sorted)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMean(t *testing.T) {
+	latencies := []time.Duration{3 * time.Millisecond, time.Millisecond, 8 * time.Millisecond}
+	if got := mean(latencies); got != 4*time.Millisecond {
+		t.Errorf("mean %v, want 4ms", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	for p, want := range map[int]time.Duration{50: 5, 90: 9, 99: 10, 100: 10} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%d %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestBench(t *testing.T) {
+	address := startTestService(t)
+
+	stdout, stderr, code := runCommand(t, "", "bench", "-n", "5", address+"/org.example.test.Echo", "{}")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	for _, want := range []string{"Calls: 5 calls", "Latency: min", "avg", "Percentiles: p50"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout %q does not contain %q", stdout, want)
+		}
+	}
+
+	_, stderr, code = runCommand(t, "", "bench", "-n", "5", address+"/org.example.test.Nope")
+	if code != exitFailure || !strings.Contains(stderr, "Call 1 failed with error: org.varlink.service.MethodNotFound") {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+}
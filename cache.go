@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+// With -interface-cache, interface descriptions are cached on disk, one
+// file per address, service version and interface, and used again until
+// they are older than -cache-ttl. A new version of the service does not
+// find the descriptions of the old one.
+var (
+	interfaceCache bool
+	cacheTTL       time.Duration
+)
+
+// cacheUsed reports whether descriptions of interfaces at address are
+// cached.
+func cacheUsed(address string) bool {
+	return interfaceCache && cacheTTL > 0 && address != "" && address != stdioAddress
+}
+
+// descriptionCachePath returns the path of the cache file for the
+// description of iface at address, as provided by version of the
+// service.
+func descriptionCachePath(address, version, iface string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(address + "\x00" + version + "\x00" + iface))
+	return filepath.Join(dir, "varlink-cmd", "interfaces", hex.EncodeToString(sum[:])), nil
+}
+
+// cachedDescription returns the cached description of iface at
+// address, if there is a fresh one for version of the service.
+func cachedDescription(std *streams, address, version, iface string) (string, bool) {
+	if !cacheUsed(address) {
+		return "", false
+	}
+	path, err := descriptionCachePath(address, version, iface)
+	if err != nil {
+		return "", false
+	}
+	fi, err := os.Stat(path)
+	if err != nil || time.Since(fi.ModTime()) > cacheTTL {
+		return "", false
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || len(b) == 0 {
+		return "", false
+	}
+	if debug {
+		fmt.Fprintf(std.err, "Using cached description of '%s' at '%s'\n", iface, address)
+	}
+	return string(b), true
+}
+
+// cacheDescription saves the description of iface at address for
+// version of the service. The cache is only a shortcut, so failing to
+// write it is not an error.
+func cacheDescription(std *streams, address, version, iface, description string) {
+	if !cacheUsed(address) {
+		return
+	}
+	if err := writeCacheFile(address, version, iface, description); err != nil && debug {
+		fmt.Fprintf(std.err, "Cannot cache description of '%s': %v\n", iface, err)
+	}
+}
+
+func writeCacheFile(address, version, iface, description string) error {
+	path, err := descriptionCachePath(address, version, iface)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Write and rename, so that readers never see half a file.
+	f, err := os.CreateTemp(filepath.Dir(path), "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(description)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// describeInterface returns the description of iface at address from
+// the cache, or asks con for it.
+func describeInterface(ctx context.Context, std *streams, con *varlink.Connection, address, iface string) (string, error) {
+	if !cacheUsed(address) {
+		return con.GetInterfaceDescription(ctx, iface)
+	}
+
+	info, err := getServiceInfo(ctx, con)
+	if err != nil {
+		return "", err
+	}
+	if description, ok := cachedDescription(std, address, info.version, iface); ok {
+		return description, nil
+	}
+	description, err := con.GetInterfaceDescription(ctx, iface)
+	if err != nil {
+		return "", err
+	}
+	cacheDescription(std, address, info.version, iface, description)
+	return description, nil
+}
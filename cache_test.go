@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterfaceCache(t *testing.T) {
+	address := startTestService(t)
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+	defer func(c bool, ttl time.Duration) { interfaceCache, cacheTTL = c, ttl }(interfaceCache, cacheTTL)
+	interfaceCache, cacheTTL = false, 10*time.Minute
+
+	// The cache is off by default.
+	if _, stderr, code := runCommand(t, "", "help", address+"/org.example.test"); code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "varlink-cmd")); !os.IsNotExist(err) {
+		t.Errorf("cache written without -interface-cache: %v", err)
+	}
+
+	interfaceCache = true
+	if _, stderr, code := runCommand(t, "", "help", address+"/org.example.test"); code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	path, err := descriptionCachePath(address, "1", "org.example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != testDescription {
+		t.Fatalf("cached description %q, %v", b, err)
+	}
+
+	// A cached description is used for the same service version only.
+	cached := strings.Replace(testDescription, "Always fails", "Cached: fails", 1)
+	if err := writeCacheFile(address, "1", "org.example.test", cached); err != nil {
+		t.Fatal(err)
+	}
+	stale := strings.Replace(testDescription, "Always fails", "Stale: fails", 1)
+	if err := writeCacheFile(address, "0", "org.example.test", stale); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code := runCommand(t, "", "help", address+"/org.example.test")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	if !strings.Contains(stdout, "Cached: fails") || strings.Contains(stdout, "Stale") {
+		t.Errorf("stdout %q", stdout)
+	}
+}
@@ -0,0 +1,1087 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+	"golang.org/x/term"
+)
+
+// callOptions are the options of call.
+type callOptions struct {
+	oneway                        bool
+	more                          bool
+	reconnect                     bool
+	maxReconnects                 int
+	resumeField                   string
+	inputFormat                   string
+	echoRequest                   bool
+	nullInput                     bool
+	outputFile                    string
+	outputAppend                  bool
+	redactList                    string
+	redactFile                    bool
+	interfaceVersion              string
+	paramFlags                    paramList
+	countBytes                    bool
+	prettyDepth                   int
+	receiveFds                    bool
+	addressFrom                   string
+	templateFile                  string
+	errorTemplate                 string
+	paramFile                     string
+	autoFile, noAutoFile          bool
+	jsonc                         bool
+	paramURL                      string
+	urlTimeout                    time.Duration
+	urlHeaders                    headerList
+	rawFlags                      uint64
+	paramsEnv                     string
+	sortKeys                      bool
+	preserveOrder                 bool
+	limit                         int
+	once                          bool
+	onEmptyReply                  string
+	summary                       bool
+	timing                        bool
+	links                         bool
+	numberMode                    string
+	warnDeprecated, failOnWarning bool
+	showErrors                    bool
+	expectFile                    string
+	ignorePaths                   pathList
+	expandStrings                 bool
+	maxString                     int
+	rawOutput                     bool
+	streamOutput                  bool
+	execCommand                   string
+	confirm                       bool
+	yes                           bool
+	defaultInterface              string
+	format                        string
+	requestID                     string
+	requestIDParam                string
+	authToken                     string
+	authTokenFile                 string
+	authField                     string
+	tee                           bool
+	checkIface                    bool
+	minify                        bool
+	keysOnly                      bool
+	help                          bool
+}
+
+func (o *callOptions) flagSet() *flag.FlagSet {
+	callFlags := flag.NewFlagSet("call", flag.ContinueOnError)
+	callFlags.BoolVar(&o.oneway, "oneway", false, "Do not wait for a reply")
+	callFlags.BoolVar(&o.more, "more", false, "Wait for multiple method returns if supported")
+	callFlags.IntVar(&o.limit, "limit", 0, "With -more, stop after N replies")
+	callFlags.BoolVar(&o.once, "once", false, "Call with -more but hang up after the first reply")
+	callFlags.StringVar(&o.execCommand, "exec", "", "Feed each reply as a JSON line to the standard input of this shell command")
+	callFlags.StringVar(&o.onEmptyReply, "on-empty-reply", "ok", "How to treat a reply without parameters [possible values: ok, warn, error]")
+	callFlags.BoolVar(&o.reconnect, "reconnect", false, "Reconnect and call again if the connection drops during -more")
+	callFlags.IntVar(&o.maxReconnects, "max-reconnects", 5, "With -reconnect, give up after this many reconnects without a reply in between")
+	callFlags.StringVar(&o.resumeField, "resume-field", "", "On -reconnect, pass this field of the last reply as a parameter")
+	callFlags.BoolVar(&o.echoRequest, "echo-request-on-error", false, "Print the parameters sent when the call fails")
+	callFlags.StringVar(&o.inputFormat, "input-format", "json", "Format of ARGUMENTS [possible values: json, yaml, toml]")
+	callFlags.BoolVar(
+		&o.nullInput,
+		"null-input",
+		false,
+		"Send an empty object as parameters; without ARGUMENTS the parameters are null",
+	)
+	callFlags.StringVar(&o.paramFile, "param-json-file", "", "Read ARGUMENTS from FILE")
+	callFlags.BoolVar(&o.autoFile, "auto-file", false, "Read ARGUMENTS from the file they name, if it exists and they do not start with '{'")
+	callFlags.BoolVar(&o.noAutoFile, "no-auto-file", false, "Always take ARGUMENTS as inline parameters, overriding -auto-file")
+	callFlags.StringVar(&o.paramsEnv, "params-env", "", "Read ARGUMENTS as JSON from the environment variable NAME")
+	callFlags.StringVar(&o.paramURL, "url", "", "Download ARGUMENTS as JSON from URL")
+	callFlags.DurationVar(&o.urlTimeout, "url-timeout", 10*time.Second, "Time to wait for the -url download")
+	callFlags.Var(&o.urlHeaders, "url-header", "Send this 'Name: value' header with the -url request (repeatable)")
+	callFlags.BoolVar(&o.jsonc, "jsonc", false, "Strip // and /* */ comments from JSON ARGUMENTS, implied for .jsonc files")
+	callFlags.Var(
+		&o.paramFlags,
+		"param",
+		"Set parameter name=value, the value is taken as JSON if valid; name:TYPE=value with TYPE int, float, bool, "+
+			"string or json fixes the type (repeatable)",
+	)
+	callFlags.StringVar(&o.format, "format", "json", "Format of the printed reply [possible values: json, csv, flat]")
+	callFlags.StringVar(&o.outputFile, "output", "", "Write the reply to FILE instead of stdout")
+	callFlags.BoolVar(&o.outputAppend, "output-append", false, "Append each reply to the -output file as one JSON line")
+	callFlags.BoolVar(&o.tee, "tee", false, "Print the reply to stdout as well as writing it uncolored to the -output file")
+	callFlags.StringVar(&o.redactList, "redact", "", "Replace the values of these comma separated fields with ***")
+	callFlags.BoolVar(&o.redactFile, "redact-file", false, "Also redact the reply written with -output")
+	callFlags.StringVar(&o.defaultInterface, "default-interface", "", "Interface of a METHOD given without one")
+	callFlags.BoolVar(&o.checkIface, "check-interface", false, "Check that the service provides the interface before calling")
+	callFlags.StringVar(&o.interfaceVersion, "interface-version", "", "Call the method of this version of the interface")
+	callFlags.BoolVar(&o.countBytes, "count-bytes", false, "Print the size of the reply parameters to stderr")
+	callFlags.BoolVar(&o.expandStrings, "expand-json-strings", false, "Print strings holding a JSON object or array as decoded values")
+	callFlags.BoolVar(&o.rawOutput, "raw", false, "Print the reply parameters exactly as received, without decoding them")
+	callFlags.BoolVar(
+		&o.streamOutput,
+		"stream-output",
+		false,
+		"With -raw, copy the reply parameters to stdout as they arrive, over a unix: or tcp: ADDRESS",
+	)
+	callFlags.IntVar(&o.maxString, "max-string", 0, "Print at most N characters of each string; -output files get them in full")
+	callFlags.BoolVar(&o.keysOnly, "keys-only", false, "Print only the sorted names of the reply parameters")
+	callFlags.BoolVar(
+		&o.minify,
+		"minify",
+		false,
+		"Print and save replies as JSON without any whitespace or colors; overrides -pretty-depth and -color",
+	)
+	callFlags.IntVar(&o.prettyDepth, "pretty-depth", 0, "Print objects and arrays nested deeper than N on a single line")
+	callFlags.StringVar(&o.addressFrom, "address-from", "", "Read the ADDRESS from the first line of FILE, waiting for a writer if it is a FIFO")
+	callFlags.BoolVar(&o.receiveFds, "receive-fds", false, "Report file descriptors passed with the reply (unix: addresses only, not with -more)")
+	callFlags.StringVar(&o.templateFile, "template-file", "", "Print each reply rendered with the Go template in FILE")
+	callFlags.StringVar(&o.errorTemplate, "error-template", "", "Print a varlink error rendered with this Go template of .Name and .Parameters")
+	callFlags.Uint64Var(
+		&o.rawFlags,
+		"raw-flags",
+		0,
+		"Also pass these numeric flags to the call; unsafe, and flags unknown to the varlink library are dropped",
+	)
+	callFlags.BoolVar(&o.sortKeys, "sort-keys", false, "Print object members sorted by name, the default")
+	callFlags.BoolVar(&o.preserveOrder, "preserve-order", false, "Print object members in the order the service sent them")
+	callFlags.BoolVar(&o.summary, "summary", false, "Print a one line summary of a successful call to stderr")
+	callFlags.BoolVar(&o.warnDeprecated, "warn-deprecated", false, "Warn if the documentation of the method marks it as deprecated")
+	callFlags.BoolVar(&o.failOnWarning, "fail-on-warning", false, "Do not call a method marked as deprecated and exit with an error")
+	callFlags.StringVar(&o.numberMode, "number-mode", "float", "Decode numbers as floats or keep their exact text [possible values: float, string]")
+	callFlags.BoolVar(&o.links, "links", false, "Print strings holding a URL as terminal hyperlinks when output is colored")
+	callFlags.BoolVar(&o.showErrors, "show-errors", false, "Print the errors the interface declares to stderr before calling")
+	callFlags.StringVar(&o.expectFile, "expect", "", "Fail with a diff if the reply differs from the JSON in FILE, an array of the replies with -more")
+	callFlags.Var(&o.ignorePaths, "ignore", "Leave this path out of the -expect comparison, e.g. .item.id (repeatable)")
+	callFlags.BoolVar(&o.timing, "timing", false, "Print the time spent connecting and in the method call to stderr")
+	callFlags.BoolVar(&o.confirm, "confirm", false, "Ask on the terminal before making the call")
+	callFlags.BoolVar(&o.yes, "yes", false, "Answer the -confirm question with yes")
+	callFlags.StringVar(&o.requestID, "request-id", "", "Print this ID for the call to stderr, 'auto' generates a UUID")
+	callFlags.StringVar(&o.requestIDParam, "request-id-param", "", "Also pass the -request-id as this parameter")
+	callFlags.StringVar(&o.authToken, "auth-token", "", "Pass this token as the -auth-field parameter; other users can see it in the process list, prefer -auth-token-file")
+	callFlags.StringVar(&o.authTokenFile, "auth-token-file", "", "Pass the token in FILE as the -auth-field parameter")
+	callFlags.StringVar(&o.authField, "auth-field", "token", "Parameter to pass the -auth-token in")
+	callFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return callFlags
+}
+
+func varlinkCall(ctx context.Context, std *streams, args []string) error {
+	return callWithBridge(ctx, std, bridge, args)
+}
+
+// callWithBridge is call, connecting through the bridge command instead
+// of the global -bridge or -connect-via.
+func callWithBridge(ctx context.Context, std *streams, bridge string, args []string) (err error) {
+	var o callOptions
+	callFlags := o.flagSet()
+	usage := func() error { return std.usage(callFlags, "<[ADDRESS/]INTERFACE.METHOD> [ARGUMENTS]") }
+	callFlags.SetOutput(std.err)
+	callFlags.Usage = func() {}
+
+	if err := callFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help {
+		return usage()
+	}
+
+	if o.once {
+		if o.limit != 0 || o.oneway {
+			std.errorf("-once cannot be combined with -limit or -oneway\n\n")
+			return usage()
+		}
+		o.more, o.limit = true, 1
+	}
+
+	if o.more && o.oneway {
+		std.errorf("-more cannot be combined with -oneway\n\n")
+		return usage()
+	}
+
+	if o.limit != 0 && !o.more {
+		std.errorf("-limit requires -more\n\n")
+		return usage()
+	}
+
+	if o.tee && o.outputFile == "" {
+		std.errorf("-tee requires -output\n\n")
+		return usage()
+	}
+
+	if o.outputAppend && o.outputFile == "" {
+		std.errorf("-output-append requires -output\n\n")
+		return usage()
+	}
+
+	if o.sortKeys && o.preserveOrder {
+		std.errorf("-sort-keys cannot be combined with -preserve-order\n\n")
+		return usage()
+	}
+
+	if o.preserveOrder && o.templateFile != "" {
+		std.errorf("-preserve-order cannot be combined with -template-file\n\n")
+		return usage()
+	}
+
+	if o.format != "json" && o.format != "csv" && o.format != "flat" {
+		std.errorf("Unknown -format '%s'\n\n", o.format)
+		return usage()
+	}
+
+	if len(o.ignorePaths) != 0 && o.expectFile == "" {
+		std.errorf("-ignore requires -expect\n\n")
+		return usage()
+	}
+
+	if o.expectFile != "" && (o.oneway || o.streamOutput) {
+		std.errorf("-expect cannot be combined with -oneway or -stream-output\n\n")
+		return usage()
+	}
+
+	if o.numberMode != "float" && o.numberMode != "string" {
+		std.errorf("Unknown -number-mode '%s'\n\n", o.numberMode)
+		return usage()
+	}
+
+	if o.onEmptyReply != "ok" && o.onEmptyReply != "warn" && o.onEmptyReply != "error" {
+		std.errorf("Unknown -on-empty-reply '%s'\n\n", o.onEmptyReply)
+		return usage()
+	}
+
+	if o.format != "json" && (o.rawOutput || o.templateFile != "" || o.outputFile != "" || o.preserveOrder) {
+		std.errorf("-format %s cannot be combined with -raw, -template-file, -output or -preserve-order\n\n", o.format)
+		return usage()
+	}
+
+	if o.rawOutput && (o.redactList != "" || o.templateFile != "" || o.preserveOrder || o.expandStrings || o.maxString > 0 || o.keysOnly) {
+		std.errorf("-raw cannot be combined with options changing the reply\n\n")
+		return usage()
+	}
+
+	if o.streamOutput && (!o.rawOutput || o.more || o.oneway || o.outputFile != "" || o.receiveFds || o.interfaceVersion != "" || o.checkIface || o.warnDeprecated || o.failOnWarning || o.showErrors) {
+		std.errorf("-stream-output requires -raw and a plain call with a single reply to stdout\n\n")
+		return usage()
+	}
+
+	if o.receiveFds && o.more {
+		std.errorf("-receive-fds cannot be combined with -more, the file descriptors could not be told apart by reply\n\n")
+		return usage()
+	}
+
+	if o.addressFrom != "" && len(bridge) != 0 {
+		std.errorf("-address-from cannot be combined with -bridge\n\n")
+		return usage()
+	}
+
+	if o.execCommand != "" && (o.oneway || o.outputFile != "" || o.format != "json" || o.templateFile != "" || o.keysOnly || o.streamOutput) {
+		std.errorf("-exec cannot be combined with -oneway, -output, -format csv or flat, -template-file, -keys-only or -stream-output\n\n")
+		return usage()
+	}
+
+	if o.templateFile != "" && o.outputFile != "" {
+		std.errorf("-template-file cannot be combined with -output\n\n")
+		return usage()
+	}
+
+	if o.errorTemplate != "" && jsonErrors {
+		std.errorf("-error-template cannot be combined with -json-errors\n\n")
+		return usage()
+	}
+
+	var errTmpl *template.Template
+	if o.errorTemplate != "" {
+		errTmpl, err = template.New("error").Parse(o.errorTemplate)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse error template: %v\n", err)
+		}
+	}
+
+	var tmpl *template.Template
+	if o.templateFile != "" {
+		tmpl, err = template.ParseFiles(o.templateFile)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot load template: %v\n", err)
+		}
+	}
+
+	var methodName string
+	var address string
+
+	// A given ADDRESS wins over the socket passed by socket activation.
+	activation := o.addressFrom == "" && useActivation(callFlags.Arg(0))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(bridge) != 0 || activation {
+		methodName = qualifyMethod(callFlags.Arg(0), o.defaultInterface)
+		if err := allowMethod(std, calledMethod(methodName, o.interfaceVersion)); err != nil {
+			return err
+		}
+	} else {
+		uri := callFlags.Arg(0)
+		if uri == "" {
+			return usage()
+		}
+
+		if o.addressFrom != "" {
+			methodName = qualifyMethod(uri, o.defaultInterface)
+			if err := allowMethod(std, calledMethod(methodName, o.interfaceVersion)); err != nil {
+				return err
+			}
+			address, err = readAddressFrom(ctx, o.addressFrom)
+			if err != nil {
+				return std.fail(exitConnection, "Cannot read address from '%s': %v\n", o.addressFrom, err)
+			}
+		} else if li := strings.LastIndex(uri, "/"); li != -1 {
+			address = uri[:li]
+			methodName = qualifyMethod(uri[li+1:], o.defaultInterface)
+			if err := allowMethod(std, calledMethod(methodName, o.interfaceVersion)); err != nil {
+				return err
+			}
+		} else {
+			methodName = qualifyMethod(uri, o.defaultInterface)
+
+			li := strings.LastIndex(methodName, ".")
+			if li == -1 {
+				return std.fail(exitFailure, "Invalid method name '%s'\n", methodName)
+			}
+			if err := allowInterface(std, calledInterface(methodName[:li], o.interfaceVersion)); err != nil {
+				return err
+			}
+			address, err = resolveAddress(ctx, std, methodName[:li])
+			if err != nil {
+				return std.fail(exitConnection, "Cannot resolve interface '%s': %v\n", methodName[:li], err)
+			}
+		}
+	}
+
+	var fds *fdConn
+	defer func() {
+		if fds != nil {
+			fds.discardFds()
+		}
+	}()
+	var connectTime time.Duration
+
+	open := func() (*varlink.Connection, error) {
+		var con *varlink.Connection
+
+		defer func(t time.Time) { connectTime += time.Since(t) }(time.Now())
+
+		if o.receiveFds {
+			if len(bridge) != 0 || activation {
+				return nil, std.fail(exitFailure, "-receive-fds needs a unix: ADDRESS\n")
+			}
+			if fds != nil {
+				fds.discardFds()
+			}
+			con, fds, err = connectWithFds(ctx, address)
+			if err != nil {
+				std.errorf("Cannot connect to '%s': %v\n", address, err)
+				std.printCauses(err)
+				return nil, exitError(exitConnection)
+			}
+		} else if len(bridge) != 0 {
+			con, err = connectBridgeCommand(ctx, std, bridge)
+			if err != nil {
+				return nil, std.fail(exitConnection, "Cannot connect with bridge '%s': %v\n", bridge, err)
+			}
+		} else if activation {
+			con, err = connectActivation(ctx, std)
+			if err != nil {
+				return nil, std.fail(exitConnection, "Cannot connect with socket activation: %v\n", err)
+			}
+		} else {
+			con = agentConnect(ctx, address)
+			if con == nil {
+				con, err = connect(ctx, std, address)
+			}
+			if err != nil {
+				std.errorf("Cannot connect to '%s': %v\n", address, err)
+				std.printCauses(err)
+				return nil, exitError(exitConnection)
+			}
+		}
+		return con, nil
+	}
+
+	var con *varlink.Connection
+	if !o.streamOutput {
+		if con, err = open(); err != nil {
+			return err
+		}
+	} else if len(bridge) != 0 || activation {
+		return std.fail(exitFailure, "-stream-output needs a unix: or tcp: ADDRESS\n")
+	}
+
+	if o.interfaceVersion != "" {
+		li := strings.LastIndex(methodName, ".")
+		if li == -1 {
+			return std.fail(exitFailure, "Invalid method name '%s'\n", methodName)
+		}
+
+		iface := methodName[:li]
+		if err := checkInterfaceVersion(ctx, con, iface, o.interfaceVersion); err != nil {
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Cannot call '%s': %v\n", methodName, err)
+		}
+		methodName = calledMethod(methodName, o.interfaceVersion)
+	}
+
+	if o.checkIface {
+		if err := checkInterface(ctx, con, methodName); err != nil {
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Cannot call '%s': %v\n", methodName, err)
+		}
+	}
+
+	if o.warnDeprecated || o.failOnWarning || o.showErrors {
+		li := strings.LastIndex(methodName, ".")
+		if li == -1 {
+			return std.fail(exitFailure, "Invalid method name '%s'\n", methodName)
+		}
+		description, err := describeInterface(ctx, std, con, address, methodName[:li])
+		if err != nil {
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Cannot get interface description for '%s': %v\n", methodName[:li], err)
+		}
+		iface, err := idl.New(description)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse interface description for '%s': %v\n", methodName[:li], err)
+		}
+
+		notice, deprecated := methodDeprecation(iface, methodName)
+		if deprecated && o.failOnWarning {
+			return std.fail(exitFailure, "'%s' is deprecated: %s\n", methodName, notice)
+		}
+		if deprecated && o.warnDeprecated {
+			fmt.Fprintf(std.err, "%s '%s' is deprecated: %s\n", errColor(color.Bold, color.FgYellow).Sprint("Warning:"), methodName, notice)
+		}
+
+		if o.showErrors {
+			fmt.Fprintln(std.err, errColor(color.Bold).Sprint("Possible errors:"))
+			printErrorList(std.err, iface, errColor(color.Bold))
+		}
+	}
+
+	var parameters string
+	var params json.RawMessage
+
+	parameters = callFlags.Arg(1)
+	// A JSON object could also be a file name, but hardly ever is.
+	if o.autoFile && !o.noAutoFile && o.paramFile == "" && !strings.HasPrefix(strings.TrimSpace(parameters), "{") {
+		if fi, err := os.Stat(parameters); err == nil && fi.Mode().IsRegular() {
+			o.paramFile, parameters = parameters, ""
+		}
+	}
+	if o.paramFile != "" {
+		if parameters != "" {
+			std.errorf("-param-json-file cannot be combined with ARGUMENTS\n\n")
+			return usage()
+		}
+		b, err := os.ReadFile(o.paramFile)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot read parameters: %v\n", err)
+		}
+		parameters = string(b)
+		if filepath.Ext(o.paramFile) == ".jsonc" {
+			o.jsonc = true
+		}
+	}
+	if o.paramURL != "" {
+		if parameters != "" || o.paramFile != "" {
+			std.errorf("-url cannot be combined with ARGUMENTS or -param-json-file\n\n")
+			return usage()
+		}
+		if o.inputFormat != "json" {
+			std.errorf("-url cannot be combined with -input-format %s, it downloads JSON\n\n", o.inputFormat)
+			return usage()
+		}
+		parameters, err = fetchParameters(ctx, o.paramURL, o.urlTimeout, o.urlHeaders)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot download parameters from '%s': %v\n", o.paramURL, err)
+		}
+	}
+	if o.paramsEnv != "" {
+		if parameters != "" || o.paramFile != "" || o.paramURL != "" {
+			std.errorf("-params-env cannot be combined with ARGUMENTS, -param-json-file or -url\n\n")
+			return usage()
+		}
+		if o.inputFormat != "json" {
+			std.errorf("-params-env cannot be combined with -input-format %s, it reads JSON\n\n", o.inputFormat)
+			return usage()
+		}
+		value := os.Getenv(o.paramsEnv)
+		if value == "" {
+			return std.fail(exitFailure, "Environment variable '%s' is not set or empty\n", o.paramsEnv)
+		}
+		parameters = value
+	}
+	if o.jsonc && parameters != "" {
+		b, err := stripJSONComments([]byte(parameters))
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse parameters: %v\n", err)
+		}
+		parameters = string(b)
+	}
+
+	if o.nullInput {
+		if parameters != "" {
+			std.errorf("-null-input cannot be combined with ARGUMENTS\n\n")
+			return usage()
+		}
+		params = json.RawMessage("{}")
+	} else if parameters == "" {
+		params = nil
+	} else {
+		params, err = parseParameters(parameters, o.inputFormat)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse parameters: %v\n", err)
+		}
+	}
+
+	if len(o.paramFlags) != 0 {
+		params, err = applyParams(params, o.paramFlags)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot set parameters: %v\n", err)
+		}
+	}
+
+	if o.requestIDParam != "" && o.requestID == "" {
+		std.errorf("-request-id-param requires -request-id\n\n")
+		return usage()
+	}
+
+	if o.requestID != "" {
+		if o.requestID == "auto" {
+			if o.requestID, err = newUUID(); err != nil {
+				return std.fail(exitFailure, "Cannot generate request ID: %v\n", err)
+			}
+		}
+		if o.requestIDParam != "" {
+			if params, err = setParameter(params, o.requestIDParam, o.requestID); err != nil {
+				return std.fail(exitFailure, "Cannot set parameters: %v\n", err)
+			}
+		}
+		fmt.Fprintf(std.err, "%s %s\n", errColor(color.Bold).Sprint("Request ID:"), o.requestID)
+	}
+
+	if o.authToken != "" && o.authTokenFile != "" {
+		std.errorf("-auth-token cannot be combined with -auth-token-file\n\n")
+		return usage()
+	}
+	if o.authTokenFile != "" {
+		b, err := os.ReadFile(o.authTokenFile)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot read token: %v\n", err)
+		}
+		o.authToken = strings.TrimRight(string(b), "\r\n")
+		if o.authToken == "" {
+			return std.fail(exitFailure, "Token file '%s' is empty\n", o.authTokenFile)
+		}
+	}
+	if o.authToken != "" {
+		if params, err = setParameter(params, o.authField, o.authToken); err != nil {
+			return std.fail(exitFailure, "Cannot set parameters: %v\n", err)
+		}
+		hideSecret(o.authToken)
+	}
+
+	if o.confirm && !o.yes {
+		if f, ok := std.in.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+			return std.fail(exitFailure, "Cannot ask for -confirm, stdin is not a terminal; use -yes\n")
+		}
+		fmt.Fprintf(std.err, "Call %s? [y/N] ", methodName)
+		answer, _ := bufio.NewReader(std.in).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return std.fail(exitFailure, "Call not confirmed\n")
+		}
+	}
+
+	var flags uint64
+	flags = 0
+	if o.oneway {
+		flags |= varlink.Oneway
+	}
+	if o.more {
+		flags |= varlink.More
+	}
+	flags |= o.rawFlags
+	// Do not wait for a reply that -raw-flags told the service not to send.
+	o.oneway = flags&varlink.Oneway != 0
+	f := newFormatter()
+	f.MaxDepth = o.prettyDepth
+	f.Links = o.links && !color.NoColor
+	ef := newStderrFormatter()
+	ef.MaxDepth = o.prettyDepth
+
+	printRequest := func() {
+		if !o.echoRequest {
+			return
+		}
+		var param interface{}
+		_ = json.Unmarshal(params, &param)
+		if o.authToken != "" {
+			param = redact(param, map[string]bool{o.authField: true})
+		}
+		c, _ := ef.Marshal(param)
+		fmt.Fprintf(std.err, "%s\n%v\n", errColor(color.Bold).Sprint("Request parameters:"), string(c))
+	}
+
+	// callFailed reports the error reply e.
+	callFailed := func(e *varlink.Error) error {
+		if errTmpl != nil {
+			printErrorTemplate(std, errTmpl, e)
+			printRequest()
+			return exitError(exitFailure)
+		}
+		std.errorf("Call failed with error: %v\n", errColor(color.FgRed).Sprint(e.Name))
+		errorRawParameters := e.Parameters.(*json.RawMessage)
+		if jsonErrors {
+			std.pendingError.Name = e.Name
+			std.pendingError.Parameters = errorRawParameters
+		} else if errorRawParameters != nil {
+			var param map[string]interface{}
+			_ = json.Unmarshal(*errorRawParameters, &param)
+			_ = printFormatted(std, std.err, ef, param)
+		}
+		printRequest()
+		return exitError(exitFailure)
+	}
+
+	if o.streamOutput {
+		if err := streamCall(ctx, std, address, methodName, params, std.out); err != nil {
+			if e, ok := varlinkError(err); ok {
+				return callFailed(e)
+			}
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			if connectionClosed(err) {
+				return std.fail(exitConnection, "Server closed connection before completing reply to '%s'\n", methodName)
+			}
+			return std.fail(exitFailure, "Error calling '%s': %v\n", methodName, err)
+		}
+		return nil
+	}
+
+	fields := parseFieldList(o.redactList)
+	totalBytes := 0
+	replies := 0
+
+	var expected interface{}
+	if o.expectFile != "" {
+		expected, err = readExpected(o.expectFile, o.numberMode == "string")
+		if err != nil {
+			return std.fail(exitFailure, "Cannot read expected reply '%s': %v\n", o.expectFile, err)
+		}
+	}
+	var received []interface{}
+	checkExpected := func(reply map[string]interface{}) error {
+		if o.expectFile == "" {
+			return nil
+		}
+		var got interface{} = reply
+		if reply == nil {
+			got = map[string]interface{}{}
+		}
+		if o.more {
+			got = received
+		}
+		diffs := ignoreDiffs(diffJSON("", expected, got), o.ignorePaths)
+		if len(diffs) == 0 {
+			return nil
+		}
+		std.errorf("Reply differs from '%s'\n", o.expectFile)
+		printDiff(std.err, diffs)
+		return exitError(exitDiffers)
+	}
+
+	start := time.Now()
+	connectedBefore := connectTime
+	printSummary := func(reply map[string]interface{}) {
+		if o.timing {
+			// Reconnecting during -more is connection time as well.
+			method := time.Since(start) - (connectTime - connectedBefore)
+			fmt.Fprintf(std.err, "%s connect %v, method %v\n",
+				errColor(color.Bold).Sprint("Timing:"),
+				connectTime.Round(time.Microsecond),
+				method.Round(time.Microsecond))
+		}
+		if !o.summary {
+			return
+		}
+		elapsed := time.Since(start).Milliseconds()
+		switch {
+		case o.oneway:
+			fmt.Fprintf(std.err, "OK: %s sent in %dms\n", methodName, elapsed)
+		case o.more:
+			fmt.Fprintf(std.err, "OK: %s returned %d replies in %dms\n", methodName, replies, elapsed)
+		default:
+			fmt.Fprintf(std.err, "OK: %s returned %d fields in %dms\n", methodName, len(reply), elapsed)
+		}
+	}
+
+	var sink *execSink
+	if o.execCommand != "" {
+		sink, err = startExec(std, o.execCommand)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot run '%s': %v\n", o.execCommand, err)
+		}
+		// The exit code of the command becomes ours.
+		defer func() {
+			if ferr := sink.finish(); err == nil {
+				err = ferr
+			}
+		}()
+	}
+
+	reconnects := 0
+	for {
+		std.trace("Calling %s", methodName)
+		recv, err := con.Send(ctx, methodName, params, flags)
+		if err != nil {
+			std.errorf("Error calling '%s': %v\n", methodName, err)
+			printRequest()
+			return exitError(exitFailure)
+		}
+
+		if o.oneway {
+			printSummary(nil)
+			return nil
+		}
+
+		var lastReply map[string]interface{}
+		dropped := false
+
+		// Each reply is written out before the next one is received, with
+		// no buffer in between, so a slow reader of stdout or of the -exec
+		// command slows down receiving, and once the socket buffers are
+		// full, the service itself.
+		for {
+			var raw json.RawMessage
+
+			cont, err := recv(ctx, &raw)
+			if err == nil {
+				std.trace("Reply complete")
+			}
+			if _, ok := varlinkError(err); err == nil || ok {
+				sawVarlink(address)
+			}
+
+			if err != nil {
+				if e, ok := varlinkError(err); ok {
+					return callFailed(e)
+				}
+				if err := notVarlink(std, err, address); err != nil {
+					return err
+				}
+				// Only a dropped connection is worth calling again.
+				if o.more && o.reconnect && connectionClosed(err) && ctx.Err() == nil && !activation {
+					dropped = true
+					break
+				}
+				if connectionClosed(err) {
+					std.errorf("Server closed connection before completing reply to '%s'\n", methodName)
+					printRequest()
+					return exitError(exitConnection)
+				}
+				std.errorf("Error calling '%s': %v\n", methodName, err)
+				printRequest()
+				return exitError(exitFailure)
+			}
+			reconnects = 0
+
+			if o.countBytes {
+				totalBytes += len(raw)
+				if o.more {
+					fmt.Fprintf(std.err, "Received %d bytes (%d total)\n", len(raw), totalBytes)
+				} else {
+					fmt.Fprintf(std.err, "Received %d bytes\n", len(raw))
+				}
+			}
+
+			if fds != nil {
+				received, err := fds.takeFds()
+				for _, fd := range received {
+					fmt.Fprintf(std.err, "%s %d: %s\n", errColor(color.Bold).Sprint("Received file descriptor"), fd, describeFd(fd))
+				}
+				// Nothing uses them beyond this report.
+				closeFds(received)
+				if err != nil {
+					return std.fail(exitFailure, "Cannot receive file descriptors of '%s': %v\n", methodName, err)
+				}
+			}
+
+			var retval map[string]interface{}
+			if raw != nil && (!o.rawOutput || o.resumeField != "" || o.summary || o.onEmptyReply != "ok" || o.expectFile != "") {
+				dec := json.NewDecoder(bytes.NewReader(raw))
+				if o.numberMode == "string" {
+					// Keep large integers and decimals exact.
+					dec.UseNumber()
+				}
+				if err := dec.Decode(&retval); err != nil {
+					if err := notVarlink(std, err, address); err != nil {
+						return err
+					}
+				}
+			}
+			lastReply = retval
+
+			if o.rawOutput {
+				if raw == nil {
+					raw = json.RawMessage("{}")
+				}
+				if o.minify {
+					var b bytes.Buffer
+					if err := json.Compact(&b, raw); err != nil {
+						if err := notVarlink(std, err, address); err != nil {
+							return err
+						}
+					}
+					raw = b.Bytes()
+				}
+				if sink != nil {
+					var b bytes.Buffer
+					if err = json.Compact(&b, raw); err == nil {
+						err = sink.write(b.Bytes())
+					}
+				} else if o.outputFile != "" {
+					err = writeOutputFile(o.outputFile, raw, o.outputAppend, o.minify)
+				} else {
+					_, err = fmt.Fprintln(std.out, string(raw))
+				}
+				if err == errExecStopped {
+					return nil
+				}
+				if err != nil {
+					return std.fail(exitFailure, "Cannot write reply: %v\n", err)
+				}
+			} else {
+				var result interface{} = retval
+				if o.preserveOrder && raw != nil {
+					if result, err = decodeOrdered(raw); err != nil {
+						if err := notVarlink(std, err, address); err != nil {
+							return err
+						}
+					}
+				}
+				if o.expandStrings {
+					result = expandJSONStrings(result)
+				}
+				saved := result
+				if fields != nil {
+					result = redact(result, fields)
+					if o.redactFile {
+						saved = result
+					}
+				}
+
+				displayed := result
+				if o.maxString > 0 {
+					displayed = truncateStrings(result, o.maxString)
+				}
+
+				if sink != nil {
+					c, err := json.Marshal(displayed)
+					if err != nil {
+						return std.fail(exitFailure, "Cannot encode reply: %v\n", err)
+					}
+					if err := sink.write(c); err == errExecStopped {
+						return nil
+					} else if err != nil {
+						return std.fail(exitFailure, "Cannot write to '%s': %v\n", o.execCommand, err)
+					}
+				} else if o.keysOnly {
+					keys := make([]string, 0, len(retval))
+					for k := range retval {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						fmt.Fprintln(std.out, k)
+					}
+				} else if o.format == "csv" {
+					reply, _ := displayed.(map[string]interface{})
+					if err := writeCSV(std.out, reply); err != nil {
+						return std.fail(exitFailure, "Cannot print reply as CSV: %v\n", err)
+					}
+				} else if o.format == "flat" {
+					if err := writeFlat(std.out, "", displayed); err != nil {
+						return std.fail(exitFailure, "Cannot print reply: %v\n", err)
+					}
+				} else if tmpl != nil {
+					if err := tmpl.Execute(std.out, displayed); err != nil {
+						return std.fail(exitFailure, "Cannot render template: %v\n", err)
+					}
+				} else if (o.outputFile == "" || o.tee) && o.minify {
+					c, err := json.Marshal(displayed)
+					if err == nil {
+						_, err = fmt.Fprintln(std.out, string(c))
+					}
+					if err != nil {
+						return std.fail(exitFailure, "Cannot print reply: %v\n", err)
+					}
+				} else if o.outputFile == "" || o.tee {
+					if err := printFormatted(std, std.out, f, displayed); err != nil {
+						return std.fail(exitFailure, "Cannot print reply: %v\n", err)
+					}
+				}
+
+				if o.outputFile != "" {
+					if err := writeOutputFile(o.outputFile, saved, o.outputAppend, o.minify); err != nil {
+						return std.fail(exitFailure, "Cannot write output to '%s': %v\n", o.outputFile, err)
+					}
+				}
+			}
+
+			if len(retval) == 0 {
+				switch o.onEmptyReply {
+				case "warn":
+					fmt.Fprintf(std.err, "%s '%s' returned an empty reply\n", errColor(color.Bold, color.FgYellow).Sprint("Warning:"), methodName)
+				case "error":
+					return std.fail(exitFailure, "'%s' returned an empty reply\n", methodName)
+				}
+			}
+
+			replies++
+			if o.more && o.expectFile != "" {
+				if retval == nil {
+					received = append(received, map[string]interface{}{})
+				} else {
+					received = append(received, retval)
+				}
+			}
+			if cont&varlink.Continues == 0 {
+				if err := checkExpected(retval); err != nil {
+					return err
+				}
+				printSummary(retval)
+				return nil
+			}
+
+			if o.limit > 0 && replies >= o.limit {
+				// Hanging up is the only way to stop a stream.
+				cancel()
+				closeConnection(con)
+				if err := checkExpected(retval); err != nil {
+					return err
+				}
+				printSummary(retval)
+				return nil
+			}
+		}
+
+		if !dropped {
+			return nil
+		}
+
+		// The stream ended without a final reply; resume it.
+		if con == bridgeCon {
+			closeBridge()
+		} else {
+			con.Close()
+		}
+		reconnects++
+		if reconnects > o.maxReconnects {
+			std.errorf("Connection to '%s' dropped, giving up after %d reconnects\n", methodName, o.maxReconnects)
+			printRequest()
+			return exitError(exitConnection)
+		}
+		if debug {
+			fmt.Fprintf(std.err, "Connection dropped, reconnecting\n")
+		}
+		select {
+		case <-ctx.Done():
+			return std.fail(exitConnection, "Connection dropped: %v\n", ctx.Err())
+		case <-time.After(reconnectDelay(reconnects)):
+		}
+		if con, err = open(); err != nil {
+			return err
+		}
+
+		if o.resumeField != "" {
+			if token, ok := lastReply[o.resumeField]; ok {
+				params, err = setParameter(params, o.resumeField, token)
+				if err != nil {
+					return std.fail(exitFailure, "Cannot set resume field '%s': %v\n", o.resumeField, err)
+				}
+			}
+		}
+	}
+}
+
+// printErrorTemplate prints the varlink error e rendered with tmpl to
+// stderr, ending it with a newline if the template does not.
+func printErrorTemplate(std *streams, tmpl *template.Template, e *varlink.Error) {
+	data := struct {
+		Name       string
+		Parameters map[string]interface{}
+	}{Name: e.Name}
+	if p, ok := e.Parameters.(*json.RawMessage); ok && p != nil {
+		_ = json.Unmarshal(*p, &data.Parameters)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		std.errorf("Cannot render error template: %v\n", err)
+		return
+	}
+	if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	std.err.Write(b.Bytes())
+}
+
+// setParameter returns params with the member name set to value.
+func setParameter(params json.RawMessage, name string, value interface{}) (json.RawMessage, error) {
+	p := make(map[string]interface{})
+	if len(params) != 0 {
+		if err := json.Unmarshal(params, &p); err != nil || p == nil {
+			return nil, errors.New("parameters are not an object")
+		}
+	}
+	p[name] = value
+	return json.Marshal(p)
+}
+
+// qualifyMethod prepends iface to method unless it already names its
+// interface.
+func qualifyMethod(method, iface string) string {
+	if iface == "" || strings.Contains(method, ".") {
+		return method
+	}
+	return iface + "." + method
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallErrorTemplate(t *testing.T) {
+	address := startTestService(t)
+
+	for _, tt := range []struct {
+		method string
+		want   string
+	}{
+		{"org.example.test.Fail", "org.example.test.NotHere code=3\n"},
+		{"org.example.test.Nope", "org.varlink.service.MethodNotFound method=Nope\n"},
+		{"org.example.nope.Fail", "org.varlink.service.InterfaceNotFound interface=org.example.nope\n"},
+	} {
+		tmpl := "{{.Name}}{{range $k, $v := .Parameters}} {{$k}}={{$v}}{{end}}"
+		stdout, stderr, code := runCommand(t, "", "call", "-error-template", tmpl, address+"/"+tt.method)
+		if code != exitFailure {
+			t.Errorf("%s: exit code %d, want %d", tt.method, code, exitFailure)
+		}
+		if stdout != "" || stderr != tt.want {
+			t.Errorf("%s: stdout %q, stderr %q, want %q", tt.method, stdout, stderr, tt.want)
+		}
+	}
+}
+
+func TestCallJSONErrors(t *testing.T) {
+	address := startTestService(t)
+	defer func(v bool) { jsonErrors = v }(jsonErrors)
+	jsonErrors = true
+
+	for _, tt := range []struct {
+		method string
+		want   string
+	}{
+		{
+			"org.example.test.Fail",
+			`{"error":"Call failed with error: org.example.test.NotHere","name":"org.example.test.NotHere","parameters":{"code":3},"exit_code":2}`,
+		},
+		{
+			"org.example.test.Nope",
+			`{"error":"Call failed with error: org.varlink.service.MethodNotFound","name":"org.varlink.service.MethodNotFound","parameters":{"method":"Nope"},"exit_code":2}`,
+		},
+	} {
+		_, stderr, code := runCommand(t, "", "call", address+"/"+tt.method)
+		if code != exitFailure {
+			t.Errorf("%s: exit code %d, want %d", tt.method, code, exitFailure)
+		}
+		if stderr != tt.want+"\n" {
+			t.Errorf("%s: stderr %s, want %s", tt.method, stderr, tt.want)
+		}
+	}
+}
+
+func TestCallExpect(t *testing.T) {
+	address := startTestService(t)
+	dir := t.TempDir()
+	echo := address + "/org.example.test.Echo"
+
+	same := filepath.Join(dir, "same.json")
+	if err := os.WriteFile(same, []byte(`{"value":{"a":1}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runCommand(t, "", "call", "-expect", same, echo, `{"value":{"a":1}}`); code != 0 {
+		t.Errorf("same reply: exit code %d, stderr %q", code, stderr)
+	}
+
+	other := filepath.Join(dir, "other.json")
+	if err := os.WriteFile(other, []byte(`{"value":{"a":2}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, code := runCommand(t, "", "call", "-expect", other, echo, `{"value":{"a":1}}`)
+	if code != exitDiffers {
+		t.Errorf("different reply: exit code %d, want %d", code, exitDiffers)
+	}
+	if !strings.Contains(stderr, "Reply differs from") {
+		t.Errorf("stderr %q", stderr)
+	}
+}
+
+func TestCallURL(t *testing.T) {
+	address := startTestService(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value":{"a":1}}`)
+	}))
+	defer server.Close()
+	echo := address + "/org.example.test.Echo"
+
+	stdout, stderr, code := runCommand(t, "", "call", "-url", server.URL, echo)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	if want := "{\n  \"value\": {\n    \"a\": 1\n  }\n}\n"; stdout != want {
+		t.Errorf("stdout %q, want %q", stdout, want)
+	}
+
+	_, stderr, code = runCommand(t, "", "call", "-url", server.URL, "-input-format", "yaml", echo)
+	if code != exitUsage {
+		t.Errorf("-url with -input-format yaml: exit code %d, want %d", code, exitUsage)
+	}
+	if !strings.Contains(stderr, "-url cannot be combined with -input-format yaml") {
+		t.Errorf("stderr %q", stderr)
+	}
+}
+
+func TestCallParamsEnv(t *testing.T) {
+	address := startTestService(t)
+	t.Setenv("TEST_PARAMS", `{"value":{"a":1}}`)
+	echo := address + "/org.example.test.Echo"
+
+	stdout, stderr, code := runCommand(t, "", "call", "-params-env", "TEST_PARAMS", echo)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	if want := "{\n  \"value\": {\n    \"a\": 1\n  }\n}\n"; stdout != want {
+		t.Errorf("stdout %q, want %q", stdout, want)
+	}
+
+	_, stderr, code = runCommand(t, "", "call", "-params-env", "TEST_PARAMS", "-input-format", "toml", echo)
+	if code != exitUsage {
+		t.Errorf("-params-env with -input-format toml: exit code %d, want %d", code, exitUsage)
+	}
+	if !strings.Contains(stderr, "-params-env cannot be combined with -input-format toml") {
+		t.Errorf("stderr %q", stderr)
+	}
+}
+
+// -confirm asks on the stdin of the command, which is no terminal
+// here even if the tests run on one.
+func TestCallConfirm(t *testing.T) {
+	address := startTestService(t)
+	echo := address + "/org.example.test.Echo"
+
+	stdout, stderr, code := runCommand(t, "y\n", "call", "-confirm", echo, "{}")
+	if code != exitFailure || stdout != "" {
+		t.Errorf("exit code %d, stdout %q", code, stdout)
+	}
+	if !strings.Contains(stderr, "stdin is not a terminal") {
+		t.Errorf("stderr %q", stderr)
+	}
+
+	if _, stderr, code := runCommand(t, "", "call", "-confirm", "-yes", echo, "{}"); code != 0 {
+		t.Errorf("-yes: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+// A service hanging up in the middle of its reply is a connection error.
+func TestCallTruncatedReply(t *testing.T) {
+	address, _ := serveRaw(t, func(n int32) string {
+		return `{"parameters":{"value":{"a":`
+	})
+
+	for _, args := range [][]string{
+		{"call", address + "/org.example.test.Echo", "{}"},
+		{"call", "-raw", "-stream-output", address + "/org.example.test.Echo", "{}"},
+	} {
+		_, stderr, code := runCommand(t, "", args...)
+		if code != exitConnection {
+			t.Errorf("%v: exit code %d, want %d", args, code, exitConnection)
+		}
+		if want := "Server closed connection before completing reply to 'org.example.test.Echo'\n"; !strings.HasSuffix(stderr, want) {
+			t.Errorf("%v: stderr %q, want %q", args, stderr, want)
+		}
+	}
+}
+
+// Without ARGUMENTS the parameters are null, with -null-input an empty
+// object, as seen on the wire.
+func TestCallNullInput(t *testing.T) {
+	address := startTestService(t)
+	defer func(v bool) { debugFrames = v }(debugFrames)
+	debugFrames = true
+
+	for _, tt := range []struct {
+		flag, parameters string
+		want             string
+	}{
+		{"", "", `-> "{\"method\":\"org.example.test.Echo\",\"parameters\":null}\x00"`},
+		{"-null-input", "", `-> "{\"method\":\"org.example.test.Echo\",\"parameters\":{}}\x00"`},
+		{"", "{}", `-> "{\"method\":\"org.example.test.Echo\",\"parameters\":{}}\x00"`},
+	} {
+		args := []string{"call"}
+		if tt.flag != "" {
+			args = append(args, tt.flag)
+		}
+		args = append(args, address+"/org.example.test.Echo")
+		if tt.parameters != "" {
+			args = append(args, tt.parameters)
+		}
+		_, stderr, code := runCommand(t, "", args...)
+		if code != 0 {
+			t.Errorf("%v: exit code %d, stderr %q", args, code, stderr)
+		}
+		if !strings.Contains(stderr, tt.want+"\n") {
+			t.Errorf("%v: stderr %q does not contain %q", args, stderr, tt.want)
+		}
+	}
+
+	_, _, code := runCommand(t, "", "call", "-null-input", address+"/org.example.test.Echo", "{}")
+	if code != exitUsage {
+		t.Errorf("-null-input with ARGUMENTS: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestCallKeyOrder(t *testing.T) {
+	address, _ := serveRaw(t, func(n int32) string {
+		return `{"parameters":{"b":1,"a":{"d":[{"f":1,"e":2}],"c":3}}}` + "\x00"
+	})
+
+	sorted := "{\n  \"a\": {\n    \"c\": 3,\n    \"d\": [\n      {\n        \"e\": 2,\n        \"f\": 1\n      }\n    ]\n  },\n  \"b\": 1\n}\n"
+	wire := "{\n  \"b\": 1,\n  \"a\": {\n    \"d\": [\n      {\n        \"f\": 1,\n        \"e\": 2\n      }\n    ],\n    \"c\": 3\n  }\n}\n"
+	for _, tt := range []struct {
+		flag string
+		want string
+	}{
+		{"", sorted},
+		{"-sort-keys", sorted},
+		{"-preserve-order", wire},
+	} {
+		args := []string{"call"}
+		if tt.flag != "" {
+			args = append(args, tt.flag)
+		}
+		args = append(args, address+"/org.example.test.Echo", "{}")
+		stdout, stderr, code := runCommand(t, "", args...)
+		if code != 0 {
+			t.Errorf("%v: exit code %d, stderr %q", args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: stdout %q, want %q", args, stdout, tt.want)
+		}
+	}
+
+	_, _, code := runCommand(t, "", "call", "-sort-keys", "-preserve-order", address+"/org.example.test.Echo", "{}")
+	if code != exitUsage {
+		t.Errorf("-sort-keys with -preserve-order: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+// blockedWriter blocks writing until release is closed.
+type blockedWriter struct {
+	release chan struct{}
+}
+
+func (w *blockedWriter) Write(b []byte) (int, error) {
+	<-w.release
+	return len(b), nil
+}
+
+// Replies are received only as fast as stdout takes them, so a slow
+// reader holds back the service instead of replies piling up in memory.
+func TestCallMoreBackpressure(t *testing.T) {
+	const replies = 8192
+	payload := strings.Repeat("x", 1024)
+
+	path := filepath.Join(t.TempDir(), "more.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var sent atomic.Int64
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if _, err := bufio.NewReader(c).ReadString(0); err != nil {
+			return
+		}
+		for i := 1; i <= replies; i++ {
+			reply := fmt.Sprintf(`{"parameters":{"n":%d,"data":"%s"},"continues":%t}`+"\x00", i, payload, i < replies)
+			if _, err := io.WriteString(c, reply); err != nil {
+				return
+			}
+			sent.Add(int64(len(reply)))
+		}
+	}()
+
+	out := &blockedWriter{release: make(chan struct{})}
+	std := &streams{in: strings.NewReader(""), out: out, err: io.Discard}
+	done := make(chan error)
+	go func() {
+		done <- run(context.Background(), std, []string{"call", "-more", "-raw", "unix:" + path + "/org.example.test.Count", "{}"})
+	}()
+
+	// Wait for the service to be held back.
+	var stalled int64
+	for i := 0; ; i++ {
+		before := sent.Load()
+		time.Sleep(100 * time.Millisecond)
+		if after := sent.Load(); after == before && after > 0 {
+			stalled = after
+			break
+		}
+		if i == 50 {
+			close(out.release)
+			t.Fatal("service not held back")
+		}
+	}
+	// What is in flight fits in the socket buffers, far from all of the
+	// 8 MiB of replies.
+	if stalled > 1<<20 {
+		t.Errorf("%d bytes sent to a blocked reader", stalled)
+	}
+
+	close(out.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := sent.Load(); n <= stalled {
+		t.Errorf("service not resumed, %d bytes sent", n)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// chainStep is one step of a chain file:
+//
+//	{
+//	  "method": "org.example.foo.Lookup",
+//	  "parameters": {"verbose": true},
+//	  "from": "result.id",
+//	  "as": "id"
+//	}
+//
+// Except for the first step, the parameters of a call are taken from
+// the reply of the previous step. "from" selects a field of that reply
+// by its dotted path instead of using the whole reply, and "as" passes
+// the selected value as the named parameter. Static "parameters" are
+// merged on top.
+type chainStep struct {
+	Method     string                 `json:"method"`
+	Parameters map[string]interface{} `json:"parameters"`
+	From       string                 `json:"from"`
+	As         string                 `json:"as"`
+}
+
+// lookupPath returns the value at a dotted path like "items.0.name" in
+// a decoded JSON value.
+func lookupPath(v interface{}, path string) (interface{}, bool) {
+	if path == "" || path == "." {
+		return v, true
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			e, ok := t[key]
+			if !ok {
+				return nil, false
+			}
+			v = e
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func readChainStep(path string) (*chainStep, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var step chainStep
+	if err := json.Unmarshal(b, &step); err != nil {
+		return nil, err
+	}
+	if step.Method == "" {
+		return nil, fmt.Errorf("no method given")
+	}
+	return &step, nil
+}
+
+// chainParameters builds the parameters of step from the reply of the
+// previous step, which is nil for the first one.
+func chainParameters(step *chainStep, previous interface{}) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+
+	if previous != nil {
+		selected, ok := lookupPath(previous, step.From)
+		if !ok {
+			return nil, fmt.Errorf("previous reply has no field '%s'", step.From)
+		}
+
+		if step.As != "" {
+			params[step.As] = selected
+		} else if m, ok := selected.(map[string]interface{}); ok {
+			for k, v := range m {
+				params[k] = v
+			}
+		} else {
+			return nil, fmt.Errorf("'%s' of the previous reply is not an object, use \"as\" to name it", step.From)
+		}
+	}
+
+	for k, v := range step.Parameters {
+		params[k] = v
+	}
+	return params, nil
+}
+
+// chainOptions are the options of chain.
+type chainOptions struct {
+	checkIface bool
+	help       bool
+}
+
+func (o *chainOptions) flagSet() *flag.FlagSet {
+	chainFlags := flag.NewFlagSet("chain", flag.ContinueOnError)
+	chainFlags.BoolVar(&o.checkIface, "check-interface", false, "Check that the service provides the interface of each step")
+	chainFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return chainFlags
+}
+
+func varlinkChain(ctx context.Context, std *streams, args []string) error {
+	var o chainOptions
+	chainFlags := o.flagSet()
+	usage := func() error { return std.usage(chainFlags, "[ADDRESS] <STEP.json>...") }
+	chainFlags.SetOutput(std.err)
+	chainFlags.Usage = func() {}
+
+	if err := chainFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help {
+		return usage()
+	}
+
+	files := chainFlags.Args()
+	var address string
+	withAddress := len(bridge) == 0 && !activated()
+	if len(bridge) == 0 && activated() && len(files) > 0 {
+		// With socket activation, an ADDRESS may still come first.
+		if fi, err := os.Stat(files[0]); err != nil || !fi.Mode().IsRegular() {
+			withAddress = true
+		}
+	}
+	if withAddress {
+		if len(files) == 0 {
+			std.errorf("No ADDRESS or activation or bridge\n\n")
+			return usage()
+		}
+		address = files[0]
+		files = files[1:]
+	}
+
+	if len(files) == 0 {
+		return usage()
+	}
+
+	steps := make([]*chainStep, len(files))
+	for i, file := range files {
+		step, err := readChainStep(file)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot read chain step '%s': %v\n", file, err)
+		}
+		if err := allowMethod(std, step.Method); err != nil {
+			return err
+		}
+		steps[i] = step
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	con, err := openConnection(ctx, std, address)
+	if err != nil {
+		return err
+	}
+	defer closeConnection(con)
+
+	var reply interface{}
+	for i, step := range steps {
+		params, err := chainParameters(step, reply)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot build parameters for '%s': %v\n", files[i], err)
+		}
+
+		if debug {
+			fmt.Fprintf(std.err, "Calling '%s'\n", step.Method)
+		}
+
+		if o.checkIface {
+			if err := checkInterface(ctx, con, step.Method); err != nil {
+				if err := notVarlink(std, err, address); err != nil {
+					return err
+				}
+				return std.fail(exitFailure, "Cannot call '%s': %v\n", step.Method, err)
+			}
+		}
+
+		var retval map[string]interface{}
+		if err := con.Call(ctx, step.Method, params, &retval); err != nil {
+			if name, ok := varlinkErrorName(err); ok {
+				return std.fail(exitFailure, "Step '%s' failed with error: %v\n", files[i], name)
+			}
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Error calling '%s': %v\n", step.Method, err)
+		}
+		reply = retval
+	}
+
+	if err := printFormatted(std, std.out, newFormatter(), reply); err != nil {
+		return std.fail(exitFailure, "Cannot print reply: %v\n", err)
+	}
+	return nil
+}
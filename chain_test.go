@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	address := startTestService(t)
+	dir := t.TempDir()
+
+	steps := map[string]string{
+		"echo.json":  `{"method":"org.example.test.Echo","parameters":{"value":{"count":2}}}`,
+		"count.json": `{"method":"org.example.test.Count","from":"value"}`,
+		"nope.json":  `{"method":"org.example.test.Nope"}`,
+	}
+	for name, step := range steps {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(step), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, stderr, code := runCommand(t, "", "chain", address, filepath.Join(dir, "echo.json"), filepath.Join(dir, "count.json"))
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	if want := "{\n  \"n\": 1\n}\n"; stdout != want {
+		t.Errorf("stdout %q, want %q", stdout, want)
+	}
+
+	_, stderr, code = runCommand(t, "", "chain", address, filepath.Join(dir, "echo.json"), filepath.Join(dir, "nope.json"))
+	if code != exitFailure {
+		t.Errorf("exit code %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(stderr, "failed with error: org.varlink.service.MethodNotFound") {
+		t.Errorf("stderr %q does not name the error", stderr)
+	}
+}
@@ -0,0 +1,820 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/varlink/go/varlink"
+)
+
+var (
+	connectRetries  int
+	retryInterval   time.Duration
+	retryJitter     jitterFlag
+	retryOn         []string
+	keepAlive       time.Duration
+	noResolver      bool
+	followRedirects bool
+)
+
+// maxRedirects is the number of resolver redirects -follow-redirects
+// follows before giving up.
+const maxRedirects = 5
+
+// retryConditions maps the names accepted by -retry-on to a check
+// against the error returned when dialing.
+var retryConditions = map[string]func(error) bool{
+	"connrefused": func(err error) bool {
+		return errors.Is(err, syscall.ECONNREFUSED)
+	},
+	"notfound": func(err error) bool {
+		return errors.Is(err, syscall.ENOENT)
+	},
+	"timeout": func(err error) bool {
+		var ne net.Error
+		return errors.As(err, &ne) && ne.Timeout()
+	},
+	"dns": func(err error) bool {
+		var de *net.DNSError
+		return errors.As(err, &de)
+	},
+}
+
+func parseRetryOn(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var conditions []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if _, ok := retryConditions[c]; !ok {
+			return nil, fmt.Errorf("unknown retry condition '%s'", c)
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+// jitterFlag is the fraction of the retry interval randomly taken off
+// each wait. Given without a value, -retry-jitter means full jitter: a
+// wait anywhere between zero and the interval.
+type jitterFlag float64
+
+func (j *jitterFlag) String() string {
+	return strconv.FormatFloat(float64(*j), 'g', -1, 64)
+}
+
+func (j *jitterFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*j = 1
+		return nil
+	case "false":
+		*j = 0
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || f > 1 {
+		return errors.New("must be a fraction between 0 and 1")
+	}
+	*j = jitterFlag(f)
+	return nil
+}
+
+func (j *jitterFlag) IsBoolFlag() bool {
+	return true
+}
+
+// retryDelay returns the time to wait before the next retry.
+func retryDelay() time.Duration {
+	return retryInterval - time.Duration(rand.Float64()*float64(retryJitter)*float64(retryInterval))
+}
+
+// maxReconnectDelay caps the wait of reconnectDelay.
+const maxReconnectDelay = 30 * time.Second
+
+// reconnectDelay returns the wait before the nth reconnect in a row of
+// call -reconnect, which doubles from the retry delay on.
+func reconnectDelay(n int) time.Duration {
+	d := retryDelay()
+	for i := 1; i < n && d < maxReconnectDelay; i++ {
+		d *= 2
+	}
+	if d > maxReconnectDelay {
+		d = maxReconnectDelay
+	}
+	return d
+}
+
+// shouldRetry reports whether a failed connection attempt is worth
+// repeating. Without -retry-on every connection error is retried.
+func shouldRetry(err error) bool {
+	if len(retryOn) == 0 {
+		return true
+	}
+	for _, c := range retryOn {
+		if retryConditions[c](err) {
+			return true
+		}
+	}
+	return false
+}
+
+// connect opens a connection to address, retrying failed attempts
+// as configured by -connect-retries and -retry-on.
+func connect(ctx context.Context, std *streams, address string) (*varlink.Connection, error) {
+	var con *varlink.Connection
+	err := retryConnect(ctx, std, address, func() (err error) {
+		con, err = dial(ctx, std, address)
+		if err == nil {
+			debugServiceInfo(ctx, std, con)
+		}
+		return err
+	})
+	return con, err
+}
+
+// retryConnect waits for the socket of address with -poll-connect and
+// calls open until it succeeds or -connect-retries are used up.
+func retryConnect(ctx context.Context, std *streams, address string, open func() error) error {
+	waitForSocket(ctx, std, address)
+
+	for attempt := 0; ; attempt++ {
+		err := open()
+		if err == nil || attempt >= connectRetries || !shouldRetry(err) {
+			if errors.Is(err, syscall.EACCES) && strings.HasPrefix(address, "unix:") {
+				err = &permissionError{address, err}
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDelay()):
+		}
+	}
+}
+
+// resolveAddress asks the varlink resolver for the address of the
+// service implementing iface, for when no ADDRESS is given.
+func resolveAddress(ctx context.Context, std *streams, iface string) (string, error) {
+	if noResolver {
+		return "", errors.New("no ADDRESS given and -no-resolver is set")
+	}
+
+	resolver := varlink.ResolverAddress
+	for hop := 0; ; hop++ {
+		r, err := varlink.NewResolver(ctx, resolver)
+		if err != nil {
+			return "", err
+		}
+		address, err := r.Resolve(ctx, iface)
+		r.Close()
+		if err != nil || !followRedirects {
+			return address, err
+		}
+
+		// The address may belong to another resolver instead of the
+		// service, as when a service moved behind a resolver of its own.
+		redirected, err := isRedirect(ctx, address, iface)
+		if err != nil || !redirected {
+			return address, err
+		}
+		if hop == maxRedirects {
+			return "", fmt.Errorf("more than %d resolver redirects", maxRedirects)
+		}
+		if debug {
+			fmt.Fprintf(std.err, "Resolver at '%s' redirected '%s' to the resolver at '%s'\n", resolver, iface, address)
+		}
+		resolver = address
+	}
+}
+
+// isRedirect reports whether address is a resolver, which does not
+// implement iface itself.
+func isRedirect(ctx context.Context, address string, iface string) (bool, error) {
+	con, err := varlink.NewConnection(ctx, address)
+	if err != nil {
+		return false, err
+	}
+	defer con.Close()
+
+	var interfaces []string
+	if err := con.GetInfo(ctx, nil, nil, nil, nil, &interfaces); err != nil {
+		return false, err
+	}
+
+	resolver := false
+	for _, i := range interfaces {
+		if i == iface {
+			return false, nil
+		}
+		if i == "org.varlink.resolver" {
+			resolver = true
+		}
+	}
+	return resolver, nil
+}
+
+// readAddressFrom reads an address from the first line of the file at
+// path. Opening a FIFO blocks until another process opens it for
+// writing, so this waits for the address until ctx is done.
+func readAddressFrom(ctx context.Context, path string) (string, error) {
+	type result struct {
+		address string
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		f, err := os.Open(path)
+		if err != nil {
+			done <- result{"", err}
+			return
+		}
+		defer f.Close()
+
+		line, err := bufio.NewReader(f).ReadString('\n')
+		if err == io.EOF {
+			err = nil
+		}
+		done <- result{strings.TrimSpace(line), err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-done:
+		if r.err == nil && r.address == "" {
+			r.err = errors.New("no address in file")
+		}
+		return r.address, r.err
+	}
+}
+
+// checkAbstractSocket fails for unix:@NAME addresses of abstract
+// sockets on systems without them. The net package takes care of
+// them on Linux.
+func checkAbstractSocket(address string) error {
+	if !strings.HasPrefix(address, "unix:@") || runtime.GOOS == "linux" || runtime.GOOS == "android" {
+		return nil
+	}
+	return fmt.Errorf("abstract unix sockets like '%s' are only supported on Linux", address)
+}
+
+// lookupHost resolves host names for -trace.
+var lookupHost = net.DefaultResolver.LookupHost
+
+// dial opens a connection to address. With -keepalive, -trace,
+// -debug-frames or -debug, unix and TCP addresses are dialed here to set
+// up the socket, or to print the peer of unix connections from it.
+// WebSocket addresses are always dialed here.
+func dial(ctx context.Context, std *streams, address string) (*varlink.Connection, error) {
+	if address == stdioAddress {
+		return connectStdio(ctx, std)
+	}
+	if err := checkAbstractSocket(address); err != nil {
+		return nil, err
+	}
+	if err := checkScheme(address); err != nil {
+		return nil, err
+	}
+
+	if isWebSocket(address) {
+		std.trace("Connecting to %s", address)
+		c, err := dialWebSocket(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		std.trace("Connected")
+		return connectDialed(ctx, std, c)
+	}
+
+	if keepAlive == 0 && !tracing && !debugFrames && !debug {
+		return varlink.NewConnection(ctx, address)
+	}
+
+	network, addr, _ := strings.Cut(address, ":")
+	addr = strings.SplitN(addr, ";", 2)[0]
+
+	if keepAlive != 0 && network != "tcp" && debug {
+		fmt.Fprintf(std.err, "Ignoring -keepalive for '%s', it is not a TCP address\n", address)
+	}
+	if network != "tcp" && network != "unix" {
+		std.trace("Connecting to %s", address)
+		con, err := varlink.NewConnection(ctx, address)
+		if err == nil {
+			std.trace("Connected")
+		}
+		return con, err
+	}
+
+	c, err := dialConn(ctx, std, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return connectDialed(ctx, std, c)
+}
+
+// dialConn dials addr on the unix or tcp network, with -keepalive and
+// -trace. With -debug, the peer of unix connections is printed.
+func dialConn(ctx context.Context, std *streams, network, addr string) (net.Conn, error) {
+	// To trace them, host names are resolved here and, like the net
+	// package does, the addresses tried in turn.
+	addrs := []string{addr}
+	if network == "tcp" && tracing {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) == nil {
+			std.trace("Resolving %s", host)
+			resolved, err := lookupHost(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			std.trace("Resolved %s to %s", host, strings.Join(resolved, ", "))
+			addrs = addrs[:0]
+			for _, a := range resolved {
+				addrs = append(addrs, net.JoinHostPort(a, port))
+			}
+		}
+	}
+
+	d := net.Dialer{KeepAlive: keepAlive}
+	var c net.Conn
+	var err error
+	for _, addr = range addrs {
+		std.trace("Connecting to %s", addr)
+		if c, err = d.DialContext(ctx, network, addr); err == nil {
+			break
+		}
+		std.trace("Cannot connect to %s: %v", addr, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	std.trace("Connected")
+
+	if debug && network == "unix" {
+		if cred, ok := peerCred(c); ok {
+			fmt.Fprintf(std.err, "Connected to %s, peer %s\n", addr, cred)
+		}
+	}
+
+	return c, nil
+}
+
+// connectDialed returns a varlink connection over c, which was dialed
+// by us, wrapped for -trace and -debug-frames.
+func connectDialed(ctx context.Context, std *streams, c net.Conn) (*varlink.Connection, error) {
+	c = wrapConn(std, c)
+
+	con, err := connectConn(ctx, c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return con, nil
+}
+
+// wrapConn wraps c for -trace and -debug-frames.
+func wrapConn(std *streams, c net.Conn) net.Conn {
+	if tracing {
+		c = &traceConn{Conn: c, std: std}
+	}
+	if debugFrames {
+		c = &frameConn{Conn: c, std: std}
+	}
+	return c
+}
+
+// connectConn returns a varlink connection speaking over an already
+// established c. The varlink library only dials addresses itself, so c
+// is relayed through a private unix socket.
+func connectConn(ctx context.Context, c net.Conn) (*varlink.Connection, error) {
+	dir, err := os.MkdirTemp("", "varlink-cmd")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "relay")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		a, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- a
+	}()
+
+	con, err := varlink.NewConnection(ctx, "unix:"+path)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := <-accepted
+	if !ok {
+		con.Close()
+		return nil, fmt.Errorf("cannot set up connection relay")
+	}
+	go relay(a, c)
+
+	return con, nil
+}
+
+// relay copies data between a and b until either side is closed.
+func relay(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+	a.Close()
+	b.Close()
+}
+
+// activationFd returns the socket passed to us by systemd socket
+// activation. Like the varlink library does for services, it only takes
+// sockets passed to this process and, of several, the one named
+// "varlink" in LISTEN_FDNAMES.
+func activationFd() (int, bool) {
+	const listenFdsStart = 3
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return 0, false
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	if n == 1 {
+		return listenFdsStart, true
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	if len(names) != n {
+		return 0, false
+	}
+	for i, name := range names {
+		if name == "varlink" {
+			return listenFdsStart + i, true
+		}
+	}
+	return 0, false
+}
+
+// activated reports whether a socket was passed to us by systemd
+// socket activation.
+func activated() bool {
+	_, ok := activationFd()
+	return ok
+}
+
+// useActivation reports whether the socket passed by socket activation
+// is used for arg, an [ADDRESS/]NAME argument. A given ADDRESS wins.
+func useActivation(arg string) bool {
+	return activated() && !strings.Contains(arg, "/")
+}
+
+// connectActivation returns a connection over the socket passed by
+// socket activation. A connected socket is used as it is, a listening
+// one for the first connection accepted on it.
+func connectActivation(ctx context.Context, std *streams) (*varlink.Connection, error) {
+	fd, ok := activationFd()
+	if !ok {
+		return nil, errors.New("no socket passed")
+	}
+	f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+	defer f.Close()
+
+	var c net.Conn
+	if listening(f) {
+		l, err := net.FileListener(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use file descriptor %d: %v", fd, err)
+		}
+		defer l.Close()
+
+		if debug {
+			fmt.Fprintf(std.err, "Waiting for a connection on file descriptor %d\n", fd)
+		}
+		accepted := make(chan error, 1)
+		go func() {
+			var err error
+			c, err = l.Accept()
+			accepted <- err
+		}()
+		select {
+		case <-ctx.Done():
+			l.Close()
+			<-accepted
+			return nil, ctx.Err()
+		case err := <-accepted:
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		var err error
+		c, err = net.FileConn(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use file descriptor %d: %v", fd, err)
+		}
+	}
+
+	con, err := connectConn(ctx, c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	debugServiceInfo(ctx, std, con)
+	return con, nil
+}
+
+// stdioAddress is the address of a service at the other end of our
+// standard input and output, as when the tool is run by socat or from a
+// coprocess of the shell:
+//
+//	socat EXEC:'varlink call -- -/org.example.foo.Ping {}' UNIX-CONNECT:/run/org.example.foo
+//
+// It is socket activation the other way round, with a pipe instead of a
+// socket passed to us.
+const stdioAddress = "-"
+
+var stdioUsed bool
+
+// connectStdio returns a connection over standard input and output.
+// The output of the tool moves to stderr, standard output belonging to
+// the service now.
+func connectStdio(ctx context.Context, std *streams) (*varlink.Connection, error) {
+	if stdioUsed {
+		return nil, errors.New("standard input and output are already in use")
+	}
+	stdioUsed = true
+
+	out := std.out
+	std.out = std.err
+	color.Output = std.err
+
+	a, b := net.Pipe()
+	go func() {
+		_, _ = io.Copy(out, b)
+	}()
+	go func() {
+		_, _ = io.Copy(b, std.in)
+		b.Close()
+	}()
+	return connectDialed(ctx, std, a)
+}
+
+// permissionError is returned for unix sockets the user may not
+// connect to, which is a common stumbling block.
+type permissionError struct {
+	address string
+	err     error
+}
+
+func (e *permissionError) Error() string {
+	socket := strings.SplitN(strings.TrimPrefix(e.address, "unix:"), ";", 2)[0]
+	return fmt.Sprintf("permission denied connecting to %s; check socket permissions or run with appropriate privileges", socket)
+}
+
+func (e *permissionError) Unwrap() error {
+	return e.err
+}
+
+// connectionClosed reports whether err means that the service closed
+// the connection before it completed its reply.
+func connectionClosed(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// openConnection connects through the bridge, the socket passed by
+// socket activation, or to address, in that order of preference. It
+// prints an error message if no connection can be established.
+func openConnection(ctx context.Context, std *streams, address string) (*varlink.Connection, error) {
+	var con *varlink.Connection
+	var err error
+
+	if len(bridge) != 0 {
+		con, err = connectBridge(ctx, std)
+		if err != nil {
+			return nil, std.fail(exitConnection, "Cannot connect with bridge '%s': %v\n", bridge, err)
+		}
+	} else if address == "" && activated() {
+		con, err = connectActivation(ctx, std)
+		if err != nil {
+			return nil, std.fail(exitConnection, "Cannot connect with socket activation: %v\n", err)
+		}
+	} else {
+		con, err = connect(ctx, std, address)
+		if err != nil {
+			std.errorf("Cannot connect to '%s': %v\n", address, err)
+			std.printCauses(err)
+			return nil, exitError(exitConnection)
+		}
+	}
+	return con, nil
+}
+
+var serviceInfoPrinted bool
+
+// debugServiceInfo prints what the service says about itself with
+// -debug, once per run. Varlink has no handshake or protocol version to
+// negotiate, so org.varlink.service.GetInfo is the closest there is to
+// what the other end is and supports.
+func debugServiceInfo(ctx context.Context, std *streams, con *varlink.Connection) {
+	if !debug || serviceInfoPrinted {
+		return
+	}
+	serviceInfoPrinted = true
+
+	var vendor, product, version, url string
+	var interfaces []string
+	if err := con.GetInfo(ctx, &vendor, &product, &version, &url, &interfaces); err != nil {
+		fmt.Fprintf(std.err, "Service did not report its info: %v\n", err)
+		return
+	}
+	fmt.Fprintf(std.err, "Service: %s %s %s (%s), no protocol version to negotiate\n", vendor, product, version, url)
+	fmt.Fprintf(std.err, "Service interfaces: %s\n", strings.Join(interfaces, ", "))
+}
+
+// probeTimeout limits how long answersVarlink waits for an answer.
+const probeTimeout = time.Second
+
+// answersVarlink asks the unix: or tcp: address for the service info
+// and reports whether the answer, if any, looks like a varlink message.
+// spokeVarlink holds the endpoints that sent a varlink reply before,
+// which are not asked again by notVarlink.
+var spokeVarlink sync.Map
+
+// sawVarlink notes that endpoint sent a varlink reply.
+func sawVarlink(endpoint string) {
+	spokeVarlink.Store(endpoint, true)
+}
+
+// spoke reports whether endpoint sent a varlink reply before.
+func spoke(endpoint string) bool {
+	_, ok := spokeVarlink.Load(endpoint)
+	return ok
+}
+
+// The varlink library throws away an incomplete message when the
+// connection is closed, so a server of another protocol, like SSH,
+// greeting us and hanging up on a call looks like a dropped connection.
+// Asking again with a plain GetInfo call tells them apart.
+func answersVarlink(address string) bool {
+	network, addr, _ := strings.Cut(address, ":")
+	if network != "unix" && network != "tcp" {
+		return true
+	}
+	addr = strings.SplitN(addr, ";", 2)[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	var d net.Dialer
+	c, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return true
+	}
+	defer c.Close()
+	deadline, _ := ctx.Deadline()
+	_ = c.SetDeadline(deadline)
+
+	if _, err := c.Write([]byte("{\"method\":\"org.varlink.service.GetInfo\"}\x00")); err != nil {
+		return true
+	}
+	b := make([]byte, 64)
+	n, _ := c.Read(b)
+	answer := bytes.TrimSpace(b[:n])
+	if len(answer) != 0 && answer[0] == '{' {
+		sawVarlink(address)
+	}
+	return len(answer) == 0 || answer[0] == '{'
+}
+
+// notVarlink fails with a connection error if err shows that the
+// endpoint replied with something other than varlink messages, which
+// usually means the address points at the wrong service. Check it
+// before taking err for a dropped connection. A closed connection is
+// only probed with answersVarlink if endpoint never sent a varlink
+// reply, so the ordinary dropped connection is not.
+func notVarlink(std *streams, err error, endpoint string) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr) || errors.As(err, &typeErr):
+	case connectionClosed(err) && endpoint != "" && !spoke(endpoint) && !answersVarlink(endpoint):
+	default:
+		return nil
+	}
+
+	if endpoint == "" {
+		std.errorf("Endpoint does not appear to speak varlink\n")
+	} else {
+		std.errorf("Endpoint '%s' does not appear to speak varlink\n", endpoint)
+	}
+	return exitError(exitConnection)
+}
+
+// bridgeCon is the connection to the bridge command. The command is
+// started once and shared by all calls of an invocation.
+var bridgeCon *varlink.Connection
+
+// connectBridge starts the bridge command on first use and returns the
+// shared connection to it.
+func connectBridge(ctx context.Context, std *streams) (*varlink.Connection, error) {
+	return connectBridgeCommand(ctx, std, bridge)
+}
+
+// connectBridgeCommand is connectBridge for the bridge command instead
+// of the global -bridge or -connect-via.
+func connectBridgeCommand(ctx context.Context, std *streams, command string) (*varlink.Connection, error) {
+	if bridgeCon != nil {
+		return bridgeCon, nil
+	}
+
+	var con *varlink.Connection
+	var err error
+	if connectVia != "" && command == connectVia {
+		con, err = connectCommand(ctx, std)
+	} else {
+		con, err = varlink.NewBridge(command)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bridgeCon = con
+	debugServiceInfo(ctx, std, con)
+	return con, nil
+}
+
+// closeBridge closes the connection to the bridge command, if any, and
+// waits a moment for the command to exit.
+func closeBridge() {
+	if bridgeCon == nil {
+		return
+	}
+	if via != nil {
+		via.closing.Store(true)
+		defer stopCommand()
+	}
+
+	done := make(chan struct{})
+	go func(con *varlink.Connection) {
+		con.Close()
+		close(done)
+	}(bridgeCon)
+	bridgeCon = nil
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+}
+
+// closeConnection closes con unless it is the shared bridge connection,
+// which stays open until closeBridge is called.
+func closeConnection(con *varlink.Connection) {
+	if con != bridgeCon {
+		con.Close()
+	}
+}
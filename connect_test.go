@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freePort returns a TCP port on 127.0.0.1 nobody listens on.
+func freePort(t testing.TB) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+// With -trace, host names are resolved by dial, which must try all
+// addresses like the net package does.
+func TestDialTraceAddresses(t *testing.T) {
+	port := freePort(t)
+	serveTest(t, "tcp:127.0.0.1:"+port)
+
+	defer func(f func(context.Context, string) ([]string, error)) { lookupHost = f }(lookupHost)
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host != "service.test" {
+			t.Errorf("resolving %s", host)
+		}
+		// Nothing listens on 127.0.0.2.
+		return []string{"127.0.0.2", "127.0.0.1"}, nil
+	}
+	defer func(v bool) { tracing = v }(tracing)
+	tracing = true
+
+	stdout, stderr, code := runCommand(t, "", "call", "tcp:service.test:"+port+"/org.example.test.Echo", `{"value":{}}`)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	if want := "{\n  \"value\": {}\n}\n"; stdout != want {
+		t.Errorf("stdout %q, want %q", stdout, want)
+	}
+	for _, want := range []string{
+		"Resolved service.test to 127.0.0.2, 127.0.0.1",
+		"Cannot connect to 127.0.0.2:" + port,
+		"Connecting to 127.0.0.1:" + port,
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("trace %q does not contain %q", stderr, want)
+		}
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	defer func(i time.Duration, j jitterFlag) { retryInterval, retryJitter = i, j }(retryInterval, retryJitter)
+	retryInterval, retryJitter = time.Second, 0
+
+	for n, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 5: 16 * time.Second, 6: 30 * time.Second, 100: 30 * time.Second} {
+		if got := reconnectDelay(n); got != want {
+			t.Errorf("reconnectDelay(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+// serveBanner answers every connection on a TCP port with banner and
+// hangs up after the first message of the client, like servers of other
+// protocols do on varlink messages.
+func serveBanner(t *testing.T, banner string) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = c.Write([]byte(banner))
+			// Read what the client sent, so that closing does not
+			// reset the connection.
+			_, _ = c.Read(make([]byte, 1024))
+			c.Close()
+		}
+	}()
+	return "tcp:" + l.Addr().String()
+}
+
+func TestNotVarlink(t *testing.T) {
+	for _, banner := range []string{
+		"SSH-2.0-OpenSSH_9.6\r\n",
+		"HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n",
+	} {
+		address := serveBanner(t, banner)
+		for _, args := range [][]string{
+			{"call", address + "/org.example.test.Echo", "{}"},
+			{"call", "-more", "-reconnect", address + "/org.example.test.Count", `{"count":1}`},
+			{"info", address},
+			{"help", address + "/org.example.test"},
+		} {
+			_, stderr, code := runCommand(t, "", args...)
+			if code != exitConnection || !strings.Contains(stderr, "does not appear to speak varlink") {
+				t.Errorf("%q: exit code %d, stderr %q", args, code, stderr)
+			}
+		}
+	}
+}
+
+// A varlink service hanging up is a dropped connection.
+func TestConnectionClosed(t *testing.T) {
+	address := serveBanner(t, "")
+
+	_, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Echo", "{}")
+	if code != exitConnection || !strings.Contains(stderr, "Server closed connection") {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+}
+
+// Like the varlink library, only sockets passed to this process are
+// taken, and of several only the one named "varlink".
+func TestActivationFd(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	for _, tc := range []struct {
+		pid, fds, names string
+		fd              int
+		ok              bool
+	}{
+		{"", "", "", 0, false},
+		{pid, "1", "", 3, true},
+		{"1", "1", "", 0, false},
+		{pid, "0", "", 0, false},
+		{pid, "2", "", 0, false},
+		{pid, "2", "other:varlink", 4, true},
+		{pid, "2", "other:more", 0, false},
+		{pid, "2", "varlink", 0, false},
+	} {
+		t.Setenv("LISTEN_PID", tc.pid)
+		t.Setenv("LISTEN_FDS", tc.fds)
+		t.Setenv("LISTEN_FDNAMES", tc.names)
+		fd, ok := activationFd()
+		if fd != tc.fd || ok != tc.ok {
+			t.Errorf("LISTEN_PID=%s LISTEN_FDS=%s LISTEN_FDNAMES=%s: got %d, %v, want %d, %v", tc.pid, tc.fds, tc.names, fd, ok, tc.fd, tc.ok)
+		}
+	}
+}
+
+// A given ADDRESS wins over socket activation.
+func TestUseActivation(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	if !useActivation("org.example.test.Echo") {
+		t.Error("activation not used without ADDRESS")
+	}
+	if useActivation("unix:/run/test/org.example.test.Echo") {
+		t.Error("activation used with ADDRESS")
+	}
+
+	t.Setenv("LISTEN_PID", "1")
+	if useActivation("org.example.test.Echo") {
+		t.Error("activation used for another process")
+	}
+}
+
+func TestAbstractSocket(t *testing.T) {
+	address := "unix:@varlink-cmd-test-" + strconv.Itoa(os.Getpid()) + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	err := checkAbstractSocket(address)
+	if runtime.GOOS != "linux" && runtime.GOOS != "android" {
+		if err == nil || !strings.Contains(err.Error(), "only supported on Linux") {
+			t.Errorf("got %v", err)
+		}
+		_, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Echo", "{}")
+		if code != exitConnection || !strings.Contains(stderr, "only supported on Linux") {
+			t.Errorf("exit code %d, stderr %q", code, stderr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAbstractSocket("unix:/run/test"); err != nil {
+		t.Error(err)
+	}
+
+	serveTest(t, address)
+	for _, args := range [][]string{
+		{"call", address + "/org.example.test.Echo", `{"value":{"a":1}}`},
+		{"call", "-raw", "-stream-output", address + "/org.example.test.Echo", `{"value":{"a":1}}`},
+	} {
+		stdout, stderr, code := runCommand(t, "", args...)
+		if code != 0 || !strings.Contains(stdout, `"a"`) {
+			t.Errorf("%v: exit code %d, stdout %q, stderr %q", args, code, stdout, stderr)
+		}
+	}
+
+	// -trace dials the socket itself.
+	defer func(v bool) { tracing = v }(tracing)
+	tracing = true
+	stdout, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Echo", `{"value":{"a":1}}`)
+	if code != 0 || !strings.Contains(stdout, `"a"`) {
+		t.Errorf("-trace: exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"reflect"
+)
+
+type flagDescription struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+func describeFlagSet(set *flag.FlagSet) []flagDescription {
+	flags := []flagDescription{}
+	set.VisitAll(func(f *flag.Flag) {
+		typeName, usage := flag.UnquoteUsage(f)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			typeName = "bool"
+		} else if typeName == "value" {
+			// Use the Go type of flags without a name in their usage.
+			typeName = reflect.Indirect(reflect.ValueOf(f.Value)).Type().Name()
+		}
+		flags = append(flags, flagDescription{f.Name, typeName, f.DefValue, usage})
+	})
+	return flags
+}
+
+// describeFlags prints the global flags and the flags of each command
+// as JSON, for shell completions and documentation.
+func describeFlags(std *streams) error {
+	description := struct {
+		Global   []flagDescription            `json:"global"`
+		Commands map[string][]flagDescription `json:"commands"`
+	}{
+		Global:   describeFlagSet(flag.CommandLine),
+		Commands: make(map[string][]flagDescription),
+	}
+
+	for _, c := range commands {
+		description.Commands[c.name] = describeFlagSet(c.flags())
+	}
+
+	enc := json.NewEncoder(std.out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(description); err != nil {
+		return std.fail(exitFailure, "Cannot print flags: %v\n", err)
+	}
+	return nil
+}
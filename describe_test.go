@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestDescribeFlags(t *testing.T) {
+	stdout, stderr, code := runCommand(t, "", "__describe-flags")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+
+	var description struct {
+		Commands map[string][]flagDescription `json:"commands"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &description); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range commands {
+		flags, ok := description.Commands[c.name]
+		if !ok {
+			t.Errorf("command %s is not described", c.name)
+			continue
+		}
+		found := false
+		for _, f := range flags {
+			if f.Name == "help" && f.Type == "bool" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("command %s has no -help flag in %v", c.name, flags)
+		}
+	}
+
+	call := make(map[string]flagDescription)
+	for _, f := range description.Commands["call"] {
+		call[f.Name] = f
+	}
+	if f := call["on-empty-reply"]; f.Type != "string" || f.Default != "ok" {
+		t.Errorf("call -on-empty-reply described as %+v", f)
+	}
+	if f := call["url-timeout"]; f.Type != "duration" || f.Default != "10s" {
+		t.Errorf("call -url-timeout described as %+v", f)
+	}
+}
+
+// The flag set given to describeFlags must be the one the command
+// parses and prints in its usage.
+func TestCommandFlagSets(t *testing.T) {
+	for _, c := range commands {
+		set := c.flags()
+		if set.Name() != c.name {
+			t.Errorf("flag set of %s is named %s", c.name, set.Name())
+		}
+		stdout, stderr, code := runCommand(t, "", c.name, "-help")
+		if code != exitUsage || stdout != "" {
+			t.Errorf("%s -help: exit code %d, stdout %q", c.name, code, stdout)
+		}
+		_, options, _ := strings.Cut(stderr, "\nOptions:\n")
+		set.VisitAll(func(f *flag.Flag) {
+			if !strings.Contains(options, "-"+f.Name) {
+				t.Errorf("%s -help does not list -%s", c.name, f.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// difference is a value which is missing from or differs between two
+// JSON documents, identified by its path.
+type difference struct {
+	path     string
+	a, b     interface{}
+	inA, inB bool
+}
+
+// diffJSON compares two decoded JSON values and returns their
+// differences in a stable order.
+func diffJSON(path string, a, b interface{}) []difference {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var diffs []difference
+		for _, k := range keys {
+			ae, inA := av[k]
+			be, inB := bv[k]
+			p := path + "." + k
+			if !inA || !inB {
+				diffs = append(diffs, difference{p, ae, be, inA, inB})
+				continue
+			}
+			diffs = append(diffs, diffJSON(p, ae, be)...)
+		}
+		return diffs
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+
+		var diffs []difference
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(bv):
+				diffs = append(diffs, difference{p, av[i], nil, true, false})
+			case i >= len(av):
+				diffs = append(diffs, difference{p, nil, bv[i], false, true})
+			default:
+				diffs = append(diffs, diffJSON(p, av[i], bv[i])...)
+			}
+		}
+		return diffs
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return []difference{{path, a, b, true, true}}
+}
+
+// printDiff prints differences as removed and added lines, colored
+// like diff output.
+func printDiff(w io.Writer, diffs []difference) {
+	removed := color.New(color.FgRed)
+	added := color.New(color.FgGreen)
+
+	for _, d := range diffs {
+		path := d.path
+		if path == "" {
+			path = "."
+		}
+		if d.inA {
+			a, _ := json.Marshal(d.a)
+			fmt.Fprintln(w, removed.Sprintf("- %s: %s", path, a))
+		}
+		if d.inB {
+			b, _ := json.Marshal(d.b)
+			fmt.Fprintln(w, added.Sprintf("+ %s: %s", path, b))
+		}
+	}
+}
+
+// diffCall calls the method named by uri and returns its decoded reply.
+func diffCall(ctx context.Context, std *streams, uri string, params json.RawMessage) (interface{}, error) {
+	li := strings.LastIndex(uri, "/")
+	if li == -1 {
+		return nil, std.fail(exitFailure, "Invalid address '%s'\n", uri)
+	}
+
+	address := uri[:li]
+	methodName := uri[li+1:]
+	if err := allowMethod(std, methodName); err != nil {
+		return nil, err
+	}
+
+	con, err := connect(ctx, std, address)
+	if err != nil {
+		std.errorf("Cannot connect to '%s': %v\n", address, err)
+		std.printCauses(err)
+		return nil, exitError(exitConnection)
+	}
+	defer closeConnection(con)
+
+	recv, err := con.Send(ctx, methodName, params, 0)
+	if err != nil {
+		return nil, std.fail(exitFailure, "Error calling '%s': %v\n", uri, err)
+	}
+
+	var retval interface{}
+	if _, err := recv(ctx, &retval); err != nil {
+		if name, ok := varlinkErrorName(err); ok {
+			return nil, std.fail(exitFailure, "Call to '%s' failed with error: %v\n", uri, errColor(color.FgRed).Sprint(name))
+		}
+		if err := notVarlink(std, err, address); err != nil {
+			return nil, err
+		}
+		if connectionClosed(err) {
+			return nil, std.fail(exitConnection, "Server closed connection before completing reply to '%s'\n", uri)
+		}
+		return nil, std.fail(exitFailure, "Error calling '%s': %v\n", uri, err)
+	}
+	return retval, nil
+}
+
+// diffOptions are the options of diff.
+type diffOptions struct {
+	inputFormat string
+	help        bool
+}
+
+func (o *diffOptions) flagSet() *flag.FlagSet {
+	diffFlags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	diffFlags.StringVar(&o.inputFormat, "input-format", "json", "Format of ARGUMENTS [possible values: json, yaml, toml]")
+	diffFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return diffFlags
+}
+
+func varlinkDiff(ctx context.Context, std *streams, args []string) error {
+	var err error
+
+	var o diffOptions
+	diffFlags := o.flagSet()
+	usage := func() error {
+		return std.usage(diffFlags, "<ADDRESS/INTERFACE.METHOD> <ADDRESS/INTERFACE.METHOD> [ARGUMENTS]")
+	}
+	diffFlags.SetOutput(std.err)
+	diffFlags.Usage = func() {}
+
+	if err := diffFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || diffFlags.NArg() < 2 {
+		return usage()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var params json.RawMessage
+	if parameters := diffFlags.Arg(2); parameters != "" {
+		params, err = parseParameters(parameters, o.inputFormat)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse parameters: %v\n", err)
+		}
+	}
+
+	a, err := diffCall(ctx, std, diffFlags.Arg(0), params)
+	if err != nil {
+		return err
+	}
+	b, err := diffCall(ctx, std, diffFlags.Arg(1), params)
+	if err != nil {
+		return err
+	}
+
+	diffs := diffJSON("", a, b)
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(std.out, bold.Sprintf("--- %s", diffFlags.Arg(0)))
+	fmt.Fprintln(std.out, bold.Sprintf("+++ %s", diffFlags.Arg(1)))
+	printDiff(std.out, diffs)
+	return exitError(exitDiffers)
+}
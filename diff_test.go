@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	address := startTestService(t)
+	echo := address + "/org.example.test.Echo"
+
+	stdout, stderr, code := runCommand(t, "", "diff", echo, echo, `{"value":{"a":1}}`)
+	if code != 0 || stdout != "" {
+		t.Errorf("same replies: exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	// Count without more replies with its first value only, which
+	// differs from the echoed parameters.
+	stdout, stderr, code = runCommand(t, "", "diff", echo, address+"/org.example.test.Count", `{"count":1}`)
+	if code != exitDiffers {
+		t.Errorf("different replies: exit code %d, want %d, stderr %q", code, exitDiffers, stderr)
+	}
+	if !strings.Contains(stdout, "--- "+echo) {
+		t.Errorf("stdout %q", stdout)
+	}
+}
+
+func TestDiffInterface(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.varlink")
+	new := filepath.Join(dir, "new.varlink")
+	if err := os.WriteFile(old, []byte(testDescription), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed := strings.Replace(testDescription, "error NotHere (code: int)", "error NotHere (code: int, reason: string)", 1)
+	if err := os.WriteFile(new, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout, stderr, code := runCommand(t, "", "diff-interface", old, old); code != 0 {
+		t.Errorf("same interfaces: exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	stdout, stderr, code := runCommand(t, "", "diff-interface", old, new)
+	if code != exitDiffers {
+		t.Errorf("different interfaces: exit code %d, want %d, stderr %q", code, exitDiffers, stderr)
+	}
+	if !strings.Contains(stdout, "NotHere") {
+		t.Errorf("stdout %q does not name the changed error", stdout)
+	}
+}
+
+func TestDiffError(t *testing.T) {
+	address := startTestService(t)
+
+	_, stderr, code := runCommand(t, "", "diff", address+"/org.example.test.Echo", address+"/org.example.test.Nope")
+	if code != exitFailure {
+		t.Errorf("exit code %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(stderr, "failed with error: org.varlink.service.MethodNotFound") {
+		t.Errorf("stderr %q does not name the error", stderr)
+	}
+}
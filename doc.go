@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/varlink/go/varlink/idl"
+)
+
+// writeMarkdown writes the documentation of iface as markdown, with a
+// section for each type, method and error.
+func writeMarkdown(w io.Writer, iface *idl.IDL) {
+	fmt.Fprintf(w, "# %s\n", iface.Name)
+	writeMarkdownDoc(w, iface.Doc)
+
+	if len(iface.Aliases) > 0 {
+		fmt.Fprintf(w, "\n## Types\n")
+		for _, a := range iface.Aliases {
+			writeMarkdownMember(w, a.Name, a.Doc, "type "+a.Name+" "+typeString(a.Type))
+		}
+	}
+
+	if len(iface.Methods) > 0 {
+		fmt.Fprintf(w, "\n## Methods\n")
+		for _, m := range iface.Methods {
+			writeMarkdownMember(w, m.Name, m.Doc, "method "+m.Name+typeString(m.In)+" -> "+typeString(m.Out))
+		}
+	}
+
+	if len(iface.Errors) > 0 {
+		fmt.Fprintf(w, "\n## Errors\n")
+		for _, e := range iface.Errors {
+			writeMarkdownMember(w, e.Name, e.Doc, "error "+e.Name+" "+typeString(e.Type))
+		}
+	}
+}
+
+func writeMarkdownMember(w io.Writer, name, doc, signature string) {
+	fmt.Fprintf(w, "\n### %s\n", name)
+	writeMarkdownDoc(w, doc)
+	fmt.Fprintf(w, "\n```\n%s\n```\n", signature)
+}
+
+func writeMarkdownDoc(w io.Writer, doc string) {
+	if doc = strings.TrimSpace(doc); doc != "" {
+		fmt.Fprintf(w, "\n%s\n", doc)
+	}
+}
+
+// loadDescription returns the interface description in the file arg
+// or, if there is no such file, of the interface [ADDRESS/]INTERFACE
+// named by arg. It prints an error message if it cannot.
+func loadDescription(ctx context.Context, std *streams, arg string) (string, error) {
+	var description string
+	if fi, err := os.Stat(arg); err == nil && fi.Mode().IsRegular() {
+		b, err := os.ReadFile(arg)
+		if err != nil {
+			return "", std.fail(exitFailure, "Cannot read '%s': %v\n", arg, err)
+		}
+		description = string(b)
+	} else {
+		var address string
+		interfaceName := arg
+		if len(bridge) == 0 && !useActivation(interfaceName) {
+			li := strings.LastIndex(interfaceName, "/")
+			if li == -1 {
+				return "", std.fail(exitFailure, "No file or address '%s'\n", interfaceName)
+			}
+			address = interfaceName[:li]
+			interfaceName = interfaceName[li+1:]
+		}
+		if err := allowInterface(std, interfaceName); err != nil {
+			return "", err
+		}
+
+		con, err := openConnection(ctx, std, address)
+		if err != nil {
+			return "", err
+		}
+		defer closeConnection(con)
+
+		description, err = describeInterface(ctx, std, con, address, interfaceName)
+		if err != nil {
+			if err := notVarlink(std, err, address); err != nil {
+				return "", err
+			}
+			return "", std.fail(exitFailure, "Cannot get interface description for '%s': %v\n", interfaceName, err)
+		}
+	}
+	return description, nil
+}
+
+// docOptions are the options of doc.
+type docOptions struct {
+	help bool
+}
+
+func (o *docOptions) flagSet() *flag.FlagSet {
+	docFlags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	docFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return docFlags
+}
+
+func varlinkDoc(ctx context.Context, std *streams, args []string) error {
+	var o docOptions
+	docFlags := o.flagSet()
+	usage := func() error { return std.usage(docFlags, "<FILE.varlink | [ADDRESS/]INTERFACE>") }
+	docFlags.SetOutput(std.err)
+	docFlags.Usage = func() {}
+
+	if err := docFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || docFlags.NArg() != 1 {
+		return usage()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	arg := docFlags.Arg(0)
+	description, err := loadDescription(ctx, std, arg)
+	if err != nil {
+		return err
+	}
+
+	iface, err := idl.New(description)
+	if err != nil {
+		return std.fail(exitFailure, "Cannot parse interface description for '%s': %v\n", arg, err)
+	}
+	writeMarkdown(std.out, iface)
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+// placeholder matches the {{column}} placeholders of a call-each
+// parameters template.
+var placeholder = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// fillTemplate returns a copy of the decoded template with the
+// placeholders in its strings replaced by the cells of row. A string
+// consisting of only a placeholder takes the type of the cell like
+// -param does, so "{{count}}" can become a number.
+func fillTemplate(v interface{}, row map[string]string) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			f, err := fillTemplate(e, row)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = f
+		}
+		return m, nil
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			f, err := fillTemplate(e, row)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = f
+		}
+		return a, nil
+	case string:
+		var missing string
+		replace := func(s string) string {
+			column := placeholder.FindStringSubmatch(s)[1]
+			cell, ok := row[column]
+			if !ok {
+				missing = column
+			}
+			return cell
+		}
+
+		if m := placeholder.FindStringSubmatchIndex(v); m != nil && m[0] == 0 && m[1] == len(v) {
+			cell := replace(v)
+			if missing != "" {
+				return nil, fmt.Errorf("no column '%s'", missing)
+			}
+			return inferValue(cell), nil
+		}
+
+		s := placeholder.ReplaceAllStringFunc(v, replace)
+		if missing != "" {
+			return nil, fmt.Errorf("no column '%s'", missing)
+		}
+		return s, nil
+	}
+	return v, nil
+}
+
+// callEachOptions are the options of call-each.
+type callEachOptions struct {
+	asArray     bool
+	countErrors bool
+	help        bool
+}
+
+func (o *callEachOptions) flagSet() *flag.FlagSet {
+	eachFlags := flag.NewFlagSet("call-each", flag.ContinueOnError)
+	eachFlags.BoolVar(&o.asArray, "array", false, "Print the replies as one JSON array instead of one per line")
+	eachFlags.BoolVar(&o.countErrors, "count-errors", false, "Print the number of successful calls and of each error to stderr at the end")
+	eachFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return eachFlags
+}
+
+func varlinkCallEach(ctx context.Context, std *streams, args []string) error {
+	var o callEachOptions
+	eachFlags := o.flagSet()
+	usage := func() error { return std.usage(eachFlags, "<TEMPLATE.json> <DATA.csv> <[ADDRESS/]INTERFACE.METHOD>") }
+	eachFlags.SetOutput(std.err)
+	eachFlags.Usage = func() {}
+
+	if err := eachFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || eachFlags.NArg() != 3 {
+		return usage()
+	}
+
+	b, err := os.ReadFile(eachFlags.Arg(0))
+	if err != nil {
+		return std.fail(exitFailure, "Cannot read template: %v\n", err)
+	}
+	var template interface{}
+	if err := json.Unmarshal(b, &template); err != nil {
+		return std.fail(exitFailure, "Cannot parse template '%s': %v\n", eachFlags.Arg(0), err)
+	}
+
+	f, err := os.Open(eachFlags.Arg(1))
+	if err != nil {
+		return std.fail(exitFailure, "Cannot read data: %v\n", err)
+	}
+	records, err := csv.NewReader(f).ReadAll()
+	f.Close()
+	if err != nil {
+		return std.fail(exitFailure, "Cannot parse data '%s': %v\n", eachFlags.Arg(1), err)
+	}
+	if len(records) == 0 {
+		return std.fail(exitFailure, "Data '%s' has no header line\n", eachFlags.Arg(1))
+	}
+	header, rows := records[0], records[1:]
+
+	var address string
+	methodName := eachFlags.Arg(2)
+	if len(bridge) == 0 && !useActivation(methodName) {
+		li := strings.LastIndex(methodName, "/")
+		if li == -1 {
+			return std.fail(exitFailure, "Invalid address '%s'\n", methodName)
+		}
+		address = methodName[:li]
+		methodName = methodName[li+1:]
+	}
+	if err := allowMethod(std, methodName); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	con, err := openConnection(ctx, std, address)
+	if err != nil {
+		return err
+	}
+	defer closeConnection(con)
+
+	replies := make([]interface{}, 0, len(rows))
+	failed := false
+	succeeded := 0
+	errorCounts := make(map[string]int)
+	for i, record := range rows {
+		row := make(map[string]string, len(header))
+		for j, column := range header {
+			if j < len(record) {
+				row[column] = record[j]
+			}
+		}
+
+		// Line numbers count the header line.
+		line := i + 2
+
+		params, err := fillTemplate(template, row)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot fill template with line %d: %v\n", line, err)
+		}
+
+		var reply map[string]interface{}
+		if err := con.Call(ctx, methodName, params, &reply); err != nil {
+			if name, ok := varlinkErrorName(err); ok {
+				std.errorf("Call for line %d failed with error: %v\n", line, name)
+				failed = true
+				errorCounts[name]++
+				continue
+			}
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Error calling '%s' for line %d: %v\n", methodName, line, err)
+		}
+		succeeded++
+
+		if o.asArray {
+			replies = append(replies, reply)
+			continue
+		}
+		c, _ := json.Marshal(reply)
+		fmt.Fprintln(std.out, string(c))
+	}
+
+	if o.asArray {
+		if err := printFormatted(std, std.out, newFormatter(), replies); err != nil {
+			return std.fail(exitFailure, "Cannot print replies: %v\n", err)
+		}
+	}
+
+	if o.countErrors {
+		printErrorCounts(std.err, succeeded, errorCounts)
+	}
+
+	if failed {
+		return exitError(exitFailure)
+	}
+	return nil
+}
+
+// varlinkErrorName returns the name of the error a service replied
+// with, including the org.varlink.service errors the varlink library
+// returns as types of their own.
+func varlinkErrorName(err error) (string, bool) {
+	if e, ok := varlinkError(err); ok {
+		return e.Name, true
+	}
+	return "", false
+}
+
+// varlinkError returns the error a service replied with as a
+// *varlink.Error with its parameters as *json.RawMessage, turning the
+// org.varlink.service errors of the varlink library back into one.
+func varlinkError(err error) (*varlink.Error, bool) {
+	switch e := err.(type) {
+	case *varlink.Error:
+		return e, true
+	case *varlink.InterfaceNotFound, *varlink.MethodNotFound, *varlink.MethodNotImplemented, *varlink.InvalidParameter:
+		b, _ := json.Marshal(e)
+		p := json.RawMessage(b)
+		return &varlink.Error{Name: err.Error(), Parameters: &p}, true
+	}
+	return nil, false
+}
+
+// printErrorCounts prints how many calls succeeded and how often each
+// error occurred, the most frequent first, e.g.
+//
+//	Succeeded: 8, org.example.foo.NotFound: 2, org.example.foo.Invalid: 1
+func printErrorCounts(w io.Writer, succeeded int, errorCounts map[string]int) {
+	names := make([]string, 0, len(errorCounts))
+	for name := range errorCounts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if errorCounts[names[i]] != errorCounts[names[j]] {
+			return errorCounts[names[i]] > errorCounts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	counts := []string{fmt.Sprintf("Succeeded: %d", succeeded)}
+	for _, name := range names {
+		counts = append(counts, fmt.Sprintf("%s: %d", name, errorCounts[name]))
+	}
+	fmt.Fprintln(w, strings.Join(counts, ", "))
+}
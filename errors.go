@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// errorsOptions are the options of errors.
+type errorsOptions struct {
+	asJSON bool
+	help   bool
+}
+
+func (o *errorsOptions) flagSet() *flag.FlagSet {
+	errorsFlags := flag.NewFlagSet("errors", flag.ContinueOnError)
+	errorsFlags.BoolVar(&o.asJSON, "json", false, "Print a JSON object mapping error names to their parameter types")
+	errorsFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return errorsFlags
+}
+
+func varlinkErrors(ctx context.Context, std *streams, args []string) error {
+	var o errorsOptions
+	errorsFlags := o.flagSet()
+	usage := func() error { return std.usage(errorsFlags, "<[ADDRESS/]INTERFACE>") }
+	errorsFlags.SetOutput(std.err)
+	errorsFlags.Usage = func() {}
+
+	if err := errorsFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || errorsFlags.NArg() < 1 {
+		return usage()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var address string
+	interfaceName := errorsFlags.Arg(0)
+	if len(bridge) == 0 && !useActivation(interfaceName) {
+		li := strings.LastIndex(interfaceName, "/")
+		if li == -1 {
+			return std.fail(exitFailure, "Invalid address '%s'\n", interfaceName)
+		}
+		address = interfaceName[:li]
+		interfaceName = interfaceName[li+1:]
+	}
+	if err := allowInterface(std, interfaceName); err != nil {
+		return err
+	}
+
+	con, err := openConnection(ctx, std, address)
+	if err != nil {
+		return err
+	}
+	defer closeConnection(con)
+
+	description, err := describeInterface(ctx, std, con, address, interfaceName)
+	if err != nil {
+		if err := notVarlink(std, err, address); err != nil {
+			return err
+		}
+		return std.fail(exitFailure, "Cannot get interface description for '%s': %v\n", interfaceName, err)
+	}
+
+	iface, err := idl.New(description)
+	if err != nil {
+		return std.fail(exitFailure, "Cannot parse interface description for '%s': %v\n", interfaceName, err)
+	}
+
+	if o.asJSON {
+		// Keep the errors and their parameters in declaration order.
+		errs := &orderedObject{values: make(map[string]interface{})}
+		for _, e := range iface.Errors {
+			params := &orderedObject{values: make(map[string]interface{})}
+			for _, f := range e.Type.Fields {
+				params.keys = append(params.keys, f.Name)
+				params.values[f.Name] = typeString(f.Type)
+			}
+			name := iface.Name + "." + e.Name
+			errs.keys = append(errs.keys, name)
+			errs.values[name] = params
+		}
+		c, _ := newFormatter().Marshal(errs)
+		fmt.Fprintln(std.out, string(c))
+		return nil
+	}
+
+	printErrorList(std.out, iface, bold)
+	return nil
+}
+
+// printErrorList prints the errors iface declares with their
+// parameters, one per line.
+func printErrorList(w io.Writer, iface *idl.IDL, name *color.Color) {
+	for _, e := range iface.Errors {
+		fmt.Fprintf(w, "%s %s\n", name.Sprint(iface.Name+"."+e.Name), typeString(e.Type))
+	}
+}
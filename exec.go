@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// execSink feeds replies to the standard input of a command for
+// call -exec, one JSON document per line.
+type execSink struct {
+	std     *streams
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+}
+
+// errExecStopped is returned by write once the command stopped reading.
+var errExecStopped = errors.New("command stopped reading")
+
+func startExec(std *streams, command string) (*execSink, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = std.out
+	cmd.Stderr = std.err
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &execSink{std: std, command: command, cmd: cmd, stdin: stdin}, nil
+}
+
+// write sends line to the command. If the command has stopped reading,
+// it returns errExecStopped and the caller is expected to finish.
+func (s *execSink) write(line []byte) error {
+	_, err := s.stdin.Write(append(line, '\n'))
+	if errors.Is(err, syscall.EPIPE) {
+		return errExecStopped
+	}
+	return err
+}
+
+// finish closes the input of the command and waits for it. If it
+// failed, the returned error carries its exit code.
+func (s *execSink) finish() error {
+	s.stdin.Close()
+	err := s.cmd.Wait()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitError(exitErr.ExitCode())
+	}
+	if err != nil {
+		return s.std.fail(exitFailure, "Cannot run '%s': %v\n", s.command, err)
+	}
+	return nil
+}
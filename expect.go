@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// pathList collects repeated -ignore paths, written like the paths
+// printed for differences, with or without the leading dot.
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathList) Set(s string) error {
+	if !strings.HasPrefix(s, ".") && !strings.HasPrefix(s, "[") {
+		s = "." + s
+	}
+	*p = append(*p, s)
+	return nil
+}
+
+// readExpected reads the golden JSON document of call -expect, decoding
+// numbers like the reply is decoded so that they compare equal.
+func readExpected(path string, useNumber bool) (interface{}, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if useNumber {
+		dec.UseNumber()
+	}
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ignoreDiffs returns the differences not at or below one of the
+// ignored paths.
+func ignoreDiffs(diffs []difference, ignore []string) []difference {
+	var kept []difference
+	for _, d := range diffs {
+		ignored := false
+		for _, i := range ignore {
+			if d.path == i || strings.HasPrefix(d.path, i+".") || strings.HasPrefix(d.path, i+"[") {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
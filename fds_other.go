@@ -0,0 +1,33 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/varlink/go/varlink"
+)
+
+type fdConn struct{}
+
+func (c *fdConn) takeFds() ([]int, error) {
+	return nil, nil
+}
+
+func (c *fdConn) discardFds() {}
+
+func closeFds(fds []int) {}
+
+func connectWithFds(ctx context.Context, address string) (*varlink.Connection, *fdConn, error) {
+	return nil, nil, errors.New("receiving file descriptors is not supported on this platform")
+}
+
+func describeFd(fd int) string {
+	return "unknown"
+}
+
+func listening(f *os.File) bool {
+	return false
+}
@@ -0,0 +1,149 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/varlink/go/varlink"
+)
+
+// maxFds is the number of file descriptors accepted with a single read,
+// the most Linux passes with one message.
+var maxFds = 253
+
+var errFdsTruncated = errors.New("more file descriptors were passed than could be received")
+
+// fdConn is a unix socket connection which collects the file
+// descriptors the service passes alongside its messages.
+//
+// The connection is read through the relay of connectConn, which reads
+// ahead of the replies, so the descriptors cannot be told apart by
+// reply. call therefore only takes them for a single reply.
+type fdConn struct {
+	*net.UnixConn
+
+	mu        sync.Mutex
+	fds       []int
+	truncated bool
+}
+
+func (c *fdConn) Read(b []byte) (int, error) {
+	oob := make([]byte, syscall.CmsgSpace(4*maxFds))
+	n, oobn, flags, _, err := c.ReadMsgUnix(b, oob)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if flags&syscall.MSG_CTRUNC != 0 {
+		// The kernel closed the descriptors that did not fit.
+		c.truncated = true
+	}
+	if oobn > 0 {
+		msgs, perr := syscall.ParseSocketControlMessage(oob[:oobn])
+		if perr == nil {
+			for i := range msgs {
+				if fds, err := syscall.ParseUnixRights(&msgs[i]); err == nil {
+					c.fds = append(c.fds, fds...)
+				}
+			}
+		}
+	}
+	return n, err
+}
+
+// takeFds returns the file descriptors received since the last call,
+// which the caller has to close. It fails with errFdsTruncated if some
+// were dropped.
+func (c *fdConn) takeFds() ([]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fds := c.fds
+	c.fds = nil
+	if c.truncated {
+		c.truncated = false
+		return fds, errFdsTruncated
+	}
+	return fds, nil
+}
+
+// discardFds closes the file descriptors nobody took. The relay closes
+// the connection as soon as the service hangs up, which can be before
+// the reply is handled, so this is left to the caller.
+func (c *fdConn) discardFds() {
+	fds, _ := c.takeFds()
+	closeFds(fds)
+}
+
+// closeFds closes received file descriptors.
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		_ = syscall.Close(fd)
+	}
+}
+
+// connectWithFds connects to a unix: address and returns the
+// connection along with the collector of passed file descriptors.
+func connectWithFds(ctx context.Context, address string) (*varlink.Connection, *fdConn, error) {
+	path, ok := strings.CutPrefix(address, "unix:")
+	if !ok {
+		return nil, nil, fmt.Errorf("file descriptors can only be received over unix: addresses")
+	}
+	path = strings.SplitN(path, ";", 2)[0]
+	if err := checkAbstractSocket(address); err != nil {
+		return nil, nil, err
+	}
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fc := &fdConn{UnixConn: c.(*net.UnixConn)}
+	con, err := connectConn(ctx, fc)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return con, fc, nil
+}
+
+// describeFd returns what a file descriptor refers to, like
+// "pipe:[1234]" or "/memfd:buffer (deleted)".
+func describeFd(fd int) string {
+	if target, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd)); err == nil {
+		return target
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return "unknown"
+	}
+	switch st.Mode & syscall.S_IFMT {
+	case syscall.S_IFIFO:
+		return "pipe"
+	case syscall.S_IFSOCK:
+		return "socket"
+	case syscall.S_IFREG:
+		return "file"
+	case syscall.S_IFCHR:
+		return "character device"
+	case syscall.S_IFDIR:
+		return "directory"
+	}
+	return "unknown"
+}
+
+// listening reports whether f is a listening socket.
+func listening(f *os.File) bool {
+	v, err := syscall.GetsockoptInt(int(f.Fd()), syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+	return err == nil && v != 0
+}
@@ -0,0 +1,120 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestListening(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	lf, err := l.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	if !listening(lf) {
+		t.Error("listening socket not detected")
+	}
+
+	c, err := net.DialTCP("tcp", nil, l.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	cf, err := c.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	if listening(cf) {
+		t.Error("connected socket taken for listening")
+	}
+}
+
+// servePipes answers a call with an empty reply passing the read ends
+// of n new pipes, whose write ends it returns on the channel.
+func servePipes(t *testing.T, n int) (string, <-chan []*os.File) {
+	t.Helper()
+
+	writers := make(chan []*os.File, 1)
+	address := serveConns(t, func(_ int32, c net.Conn) {
+		if _, err := bufio.NewReader(c).ReadString(0); err != nil {
+			return
+		}
+		var fds []int
+		var ws []*os.File
+		for i := 0; i < n; i++ {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer r.Close()
+			fds = append(fds, int(r.Fd()))
+			ws = append(ws, w)
+		}
+		_, _, err := c.(*net.UnixConn).WriteMsgUnix([]byte("{\"parameters\":{}}\x00"), syscall.UnixRights(fds...), nil)
+		if err != nil {
+			t.Error(err)
+		}
+		writers <- ws
+	})
+	return address, writers
+}
+
+func TestReceiveFds(t *testing.T) {
+	address, writers := servePipes(t, 1)
+
+	stdout, stderr, code := runCommand(t, "", "call", "-receive-fds", address+"/org.example.test.Pipe")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "{}") {
+		t.Errorf("unexpected reply %q", stdout)
+	}
+	if !strings.Contains(stderr, "Received file descriptor") || !strings.Contains(stderr, "pipe") {
+		t.Errorf("file descriptor not reported: %q", stderr)
+	}
+
+	// Both read ends are closed, so writing fails.
+	w := (<-writers)[0]
+	defer w.Close()
+	if _, err := w.Write([]byte("x")); !errors.Is(err, syscall.EPIPE) {
+		t.Errorf("received file descriptor left open: %v", err)
+	}
+}
+
+func TestReceiveFdsTruncated(t *testing.T) {
+	defer func(n int) { maxFds = n }(maxFds)
+	maxFds = 1
+	address, writers := servePipes(t, 3)
+
+	stdout, stderr, code := runCommand(t, "", "call", "-receive-fds", address+"/org.example.test.Pipe")
+	for _, w := range <-writers {
+		w.Close()
+	}
+	if code != exitFailure {
+		t.Fatalf("exit code %d, want %d: %s %q", code, exitFailure, stderr, stdout)
+	}
+	if !strings.Contains(stderr, errFdsTruncated.Error()) {
+		t.Errorf("truncation not reported: %q", stderr)
+	}
+}
+
+func TestReceiveFdsMore(t *testing.T) {
+	_, stderr, code := runCommand(t, "", "call", "-more", "-receive-fds", "unix:/nonexistent/org.example.test.Count")
+	if code != exitUsage {
+		t.Errorf("exit code %d, want %d: %s", code, exitUsage, stderr)
+	}
+}
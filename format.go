@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// formatter renders decoded JSON values indented and colored.
+// Containers nested deeper than MaxDepth, if set, are rendered
+// compactly on a single line. With Links, strings holding a URL are
+// rendered as terminal hyperlinks.
+type formatter struct {
+	Indent   int
+	MaxDepth int
+	Links    bool
+
+	KeyColor    *color.Color
+	StringColor *color.Color
+	NumberColor *color.Color
+	BoolColor   *color.Color
+	NullColor   *color.Color
+}
+
+// Marshal renders v. It fails for values that are not made of the
+// types produced by decoding JSON into an interface{}, and cannot be
+// encoded as JSON either.
+func (f *formatter) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := f.value(&buf, v, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *formatter) value(buf *bytes.Buffer, v interface{}, depth int) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return f.object(buf, keys, v, depth)
+	case *orderedObject:
+		return f.object(buf, v.keys, v.values, depth)
+	case []interface{}:
+		return f.array(buf, v, depth)
+	case string:
+		s, _ := json.Marshal(v)
+		if f.Links && isURL(v) {
+			// OSC 8 hyperlink escape sequences.
+			buf.WriteString("\x1b]8;;" + v + "\x1b\\" + f.StringColor.Sprint(string(s)) + "\x1b]8;;\x1b\\")
+		} else {
+			buf.WriteString(f.StringColor.Sprint(string(s)))
+		}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return &json.UnsupportedValueError{Str: strconv.FormatFloat(v, 'g', -1, 64)}
+		}
+		buf.WriteString(f.NumberColor.Sprint(strconv.FormatFloat(v, 'f', -1, 64)))
+	case json.Number:
+		buf.WriteString(f.NumberColor.Sprint(v.String()))
+	case bool:
+		buf.WriteString(f.BoolColor.Sprint(strconv.FormatBool(v)))
+	case nil:
+		buf.WriteString(f.NullColor.Sprint("null"))
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// object renders the members of m in the order of keys.
+func (f *formatter) object(buf *bytes.Buffer, keys []string, m map[string]interface{}, depth int) error {
+	if len(keys) == 0 {
+		buf.WriteString("{}")
+		return nil
+	}
+
+	expand := f.expand(depth)
+
+	buf.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteString(",")
+			if !expand {
+				buf.WriteString(" ")
+			}
+		}
+		f.newline(buf, depth+1, expand)
+
+		key, _ := json.Marshal(k)
+		buf.WriteString(f.KeyColor.Sprintf("%s: ", key))
+		if err := f.value(buf, m[k], depth+1); err != nil {
+			return err
+		}
+	}
+	f.newline(buf, depth, expand)
+	buf.WriteString("}")
+	return nil
+}
+
+func (f *formatter) array(buf *bytes.Buffer, a []interface{}, depth int) error {
+	if len(a) == 0 {
+		buf.WriteString("[]")
+		return nil
+	}
+
+	expand := f.expand(depth)
+
+	buf.WriteString("[")
+	for i, e := range a {
+		if i > 0 {
+			buf.WriteString(",")
+			if !expand {
+				buf.WriteString(" ")
+			}
+		}
+		f.newline(buf, depth+1, expand)
+		if err := f.value(buf, e, depth+1); err != nil {
+			return err
+		}
+	}
+	f.newline(buf, depth, expand)
+	buf.WriteString("]")
+	return nil
+}
+
+// expand reports whether a container at depth is spread over multiple
+// lines.
+func (f *formatter) expand(depth int) bool {
+	return f.MaxDepth == 0 || depth < f.MaxDepth
+}
+
+func (f *formatter) newline(buf *bytes.Buffer, depth int, expand bool) {
+	if !expand {
+		return
+	}
+	buf.WriteString("\n")
+	buf.WriteString(strings.Repeat(" ", f.Indent*depth))
+}
+
+// isURL reports whether s is a web URL that can be made a hyperlink.
+func isURL(s string) bool {
+	if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+		return false
+	}
+	// Control characters would end the escape sequence.
+	return !strings.ContainsFunc(s, func(r rune) bool { return r < 0x20 || r == 0x7f })
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+// frame is a varlink message captured with -debug-frames. A capture
+// has one message per line, as printed to stderr: "->" for sent or
+// "<-" for received messages, a space, and the message with its
+// terminating NUL byte as a Go quoted string:
+//
+//	-> "{\"method\":\"org.example.foo.Lookup\",\"parameters\":{\"name\":\"foo\"}}\x00"
+//	<- "{\"parameters\":{\"id\":1}}\x00"
+//
+// Other lines are ignored, so the whole stderr of a command can be
+// used as a capture.
+type frame struct {
+	sent    bool
+	message map[string]interface{}
+}
+
+func readFrames(r io.Reader) ([]frame, error) {
+	var frames []frame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		direction, quoted, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || (direction != "->" && direction != "<-") {
+			continue
+		}
+
+		s, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		var message map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSuffix(s, "\x00")), &message); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		frames = append(frames, frame{direction == "->", message})
+	}
+	return frames, scanner.Err()
+}
+
+// normalizeReply makes equal replies compare equal, whether or not
+// they spell out empty parameters or a false "continues".
+func normalizeReply(m map[string]interface{}) map[string]interface{} {
+	n := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		n[k] = v
+	}
+	if n["parameters"] == nil {
+		n["parameters"] = map[string]interface{}{}
+	}
+	if n["continues"] == false {
+		delete(n, "continues")
+	}
+	return n
+}
+
+// replayRequest sends the captured request and returns the replies
+// of the service in the form of captured messages.
+func replayRequest(ctx context.Context, con *varlink.Connection, request map[string]interface{}) ([]map[string]interface{}, error) {
+	method, _ := request["method"].(string)
+	if method == "" {
+		return nil, fmt.Errorf("request without method")
+	}
+	if request["upgrade"] == true {
+		return nil, fmt.Errorf("cannot replay upgraded connection of '%s'", method)
+	}
+
+	var flags uint64
+	if request["more"] == true {
+		flags |= varlink.More
+	}
+	if request["oneway"] == true {
+		flags |= varlink.Oneway
+	}
+	params, _ := json.Marshal(request["parameters"])
+	if request["parameters"] == nil {
+		params = nil
+	}
+
+	recv, err := con.Send(ctx, method, json.RawMessage(params), flags)
+	if err != nil || flags&varlink.Oneway != 0 {
+		return nil, err
+	}
+
+	var replies []map[string]interface{}
+	for {
+		var raw json.RawMessage
+		cont, err := recv(ctx, &raw)
+
+		reply := make(map[string]interface{})
+		if e, ok := varlinkError(err); ok {
+			reply["error"] = e.Name
+			raw = nil
+			if p, ok := e.Parameters.(*json.RawMessage); ok && p != nil {
+				raw = *p
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		if raw != nil {
+			var p interface{}
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, err
+			}
+			reply["parameters"] = p
+		}
+		if cont&varlink.Continues != 0 {
+			reply["continues"] = true
+		}
+		replies = append(replies, reply)
+
+		if cont&varlink.Continues == 0 {
+			return replies, nil
+		}
+	}
+}
+
+// replayFramesOptions are the options of replay-frames.
+type replayFramesOptions struct {
+	help bool
+}
+
+func (o *replayFramesOptions) flagSet() *flag.FlagSet {
+	framesFlags := flag.NewFlagSet("replay-frames", flag.ContinueOnError)
+	framesFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return framesFlags
+}
+
+func varlinkReplayFrames(ctx context.Context, std *streams, args []string) error {
+	var o replayFramesOptions
+	framesFlags := o.flagSet()
+	usage := func() error { return std.usage(framesFlags, "[ADDRESS] < CAPTURE") }
+	framesFlags.SetOutput(std.err)
+	framesFlags.Usage = func() {}
+
+	if err := framesFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || framesFlags.NArg() > 1 {
+		return usage()
+	}
+
+	frames, err := readFrames(newStdinReader(std))
+	if err != nil {
+		return std.fail(exitFailure, "Cannot read frames: %v\n", err)
+	}
+
+	address := framesFlags.Arg(0)
+	if address == "" && len(bridge) == 0 && !activated() {
+		// Without a service, print the capture for reading.
+		f := newFormatter()
+		for _, fr := range frames {
+			direction := "<-"
+			if fr.sent {
+				direction = "->"
+			}
+			fmt.Fprintln(std.out, bold.Sprint(direction))
+			if err := printFormatted(std, std.out, f, fr.message); err != nil {
+				return std.fail(exitFailure, "Cannot print frame: %v\n", err)
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	con, err := openConnection(ctx, std, address)
+	if err != nil {
+		return err
+	}
+	defer closeConnection(con)
+
+	differ := false
+	for i := 0; i < len(frames); i++ {
+		if !frames[i].sent {
+			continue
+		}
+		request := frames[i].message
+
+		var expected []map[string]interface{}
+		for i+1 < len(frames) && !frames[i+1].sent {
+			i++
+			expected = append(expected, normalizeReply(frames[i].message))
+		}
+
+		method, _ := request["method"].(string)
+		fmt.Fprintln(std.out, bold.Sprintf("-> %s", method))
+
+		replies, err := replayRequest(ctx, con, request)
+		if err != nil {
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Error replaying '%s': %v\n", method, err)
+		}
+
+		var got []interface{}
+		for _, r := range replies {
+			got = append(got, normalizeReply(r))
+		}
+		var want []interface{}
+		for _, r := range expected {
+			want = append(want, r)
+		}
+
+		if diffs := diffJSON("", want, got); len(diffs) > 0 {
+			differ = true
+			printDiff(std.out, diffs)
+		}
+	}
+
+	if differ {
+		return exitError(exitDiffers)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// capture returns messages as a -debug-frames capture, alternating
+// between sent and received ones.
+func capture(messages ...string) string {
+	var b strings.Builder
+	for i, m := range messages {
+		direction := "->"
+		if i%2 == 1 {
+			direction = "<-"
+		}
+		b.WriteString(direction + " " + strconv.Quote(m+"\x00") + "\n")
+	}
+	return b.String()
+}
+
+func TestReplayFrames(t *testing.T) {
+	address := startTestService(t)
+
+	stdin := capture(
+		`{"method":"org.example.test.Echo","parameters":{"value":{"a":1}}}`,
+		`{"parameters":{"value":{"a":1}}}`,
+		`{"method":"org.example.test.Fail"}`,
+		`{"error":"org.example.test.NotHere","parameters":{"code":3}}`,
+		`{"method":"org.example.test.Nope"}`,
+		`{"error":"org.varlink.service.MethodNotFound","parameters":{"method":"Nope"}}`,
+	)
+	stdout, stderr, code := runCommand(t, stdin, "replay-frames", address)
+	if code != 0 {
+		t.Errorf("exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
+
+func TestReplayFramesDiffers(t *testing.T) {
+	address := startTestService(t)
+
+	stdin := capture(
+		`{"method":"org.example.test.Nope"}`,
+		`{"error":"org.varlink.service.MethodNotFound","parameters":{"method":"Other"}}`,
+	)
+	stdout, stderr, code := runCommand(t, stdin, "replay-frames", address)
+	if code != exitDiffers {
+		t.Errorf("exit code %d, want %d, stderr %q", code, exitDiffers, stderr)
+	}
+	if !strings.Contains(stdout, "Other") || !strings.Contains(stdout, "Nope") {
+		t.Errorf("stdout %q does not show the difference", stdout)
+	}
+}
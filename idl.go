@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// memberKind returns the keyword, name and documentation of an
+// interface member.
+func memberKind(member interface{}) (string, string, string) {
+	switch m := member.(type) {
+	case *idl.Alias:
+		return "type", m.Name, m.Doc
+	case *idl.Method:
+		return "method", m.Name, m.Doc
+	case *idl.Error:
+		return "error", m.Name, m.Doc
+	}
+	return "", "", ""
+}
+
+// printDocs prints the documentation comments of the interface and each
+// of its members, without the type definitions.
+func printDocs(w io.Writer, iface *idl.IDL) {
+	fmt.Fprintln(w, bold.Sprint("interface ", iface.Name))
+	printDoc(w, iface.Doc)
+
+	for _, member := range iface.Members {
+		keyword, name, doc := memberKind(member)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, bold.Sprint(keyword, " ", name))
+		printDoc(w, doc)
+	}
+}
+
+func printDoc(w io.Writer, doc string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintln(w, strings.TrimRight("  "+line, " "))
+	}
+}
+
+// typeString returns t in interface description syntax.
+func typeString(t *idl.Type) string {
+	switch t.Kind {
+	case idl.TypeBool:
+		return "bool"
+	case idl.TypeInt:
+		return "int"
+	case idl.TypeFloat:
+		return "float"
+	case idl.TypeString:
+		return "string"
+	case idl.TypeObject:
+		return "object"
+	case idl.TypeArray:
+		return "[]" + typeString(t.ElementType)
+	case idl.TypeMaybe:
+		return "?" + typeString(t.ElementType)
+	case idl.TypeMap:
+		return "[string]" + typeString(t.ElementType)
+	case idl.TypeAlias:
+		return t.Alias
+	case idl.TypeEnum:
+		names := make([]string, len(t.Fields))
+		for i, f := range t.Fields {
+			names[i] = f.Name
+		}
+		return "(" + strings.Join(names, ", ") + ")"
+	case idl.TypeStruct:
+		fields := make([]string, len(t.Fields))
+		for i, f := range t.Fields {
+			fields[i] = f.Name + ": " + typeString(f.Type)
+		}
+		return "(" + strings.Join(fields, ", ") + ")"
+	}
+	return ""
+}
+
+// printSignatures prints each method of the interface on one line.
+func printSignatures(w io.Writer, iface *idl.IDL) {
+	for _, m := range iface.Methods {
+		fmt.Fprintf(w, "%s%s -> %s", bold.Sprint(m.Name), typeString(m.In), typeString(m.Out))
+		if _, deprecated := deprecation(m.Doc); deprecated {
+			fmt.Fprint(w, color.New(color.FgYellow).Sprint(" (deprecated)"))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// deprecation returns the notice of a doc comment that marks its member
+// as deprecated. Like in Go, that is a paragraph starting with
+// "Deprecated:", and the notice is the rest of the paragraph.
+func deprecation(doc string) (string, bool) {
+	var paragraphs [][]string
+	var paragraph []string
+	for _, line := range strings.Split(doc, "\n") {
+		// The idl package keeps the "#" of the line after an empty
+		// comment line, so that line also starts a paragraph.
+		if rest, ok := strings.CutPrefix(line, "#"); ok {
+			paragraphs = append(paragraphs, paragraph)
+			paragraph, line = nil, rest
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			paragraphs = append(paragraphs, paragraph)
+			paragraph = nil
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	paragraphs = append(paragraphs, paragraph)
+
+	for _, p := range paragraphs {
+		if notice, ok := strings.CutPrefix(strings.Join(p, " "), "Deprecated:"); ok {
+			return strings.TrimSpace(notice), true
+		}
+	}
+	return "", false
+}
+
+// methodDeprecation returns the deprecation notice of method, if its
+// documentation marks it as deprecated.
+func methodDeprecation(iface *idl.IDL, method string) (string, bool) {
+	name := method[strings.LastIndex(method, ".")+1:]
+	for _, m := range iface.Methods {
+		if m.Name == name {
+			return deprecation(m.Doc)
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/varlink/go/varlink/idl"
+)
+
+func TestDeprecation(t *testing.T) {
+	for _, tt := range []struct {
+		doc        string
+		notice     string
+		deprecated bool
+	}{
+		{"Looks up a name.", "", false},
+		{"Deprecated: use Find.", "use Find.", true},
+		{"Looks up a name.\n\nDeprecated: use Find\ninstead.", "use Find instead.", true},
+		{"Looks up a name.\n\nDeprecated:\nuse Find.\n\nMore text.", "use Find.", true},
+		// Only a paragraph starting with it counts, not any line.
+		{"Looks up a name.\nDeprecated: not this.", "", false},
+		{"Looks up a name,\nsee Deprecated: below.", "", false},
+		// As parsed by the idl package from "#" and "# Deprecated: ..." lines.
+		{"Looks up a name.\n# Deprecated: use\nFind.", "use Find.", true},
+	} {
+		notice, deprecated := deprecation(tt.doc)
+		if notice != tt.notice || deprecated != tt.deprecated {
+			t.Errorf("deprecation(%q) = %q, %v, want %q, %v", tt.doc, notice, deprecated, tt.notice, tt.deprecated)
+		}
+	}
+}
+
+func TestMethodDeprecation(t *testing.T) {
+	iface, err := idl.New(`interface org.example.test
+
+# Looks up a name.
+#
+# Deprecated: use
+# Find instead.
+method Lookup() -> ()
+
+# Finds a name.
+# Deprecated: is not a paragraph here.
+method Find() -> ()
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notice, ok := methodDeprecation(iface, "org.example.test.Lookup"); !ok || notice != "use Find instead." {
+		t.Errorf("Lookup: %q, %v", notice, ok)
+	}
+	if notice, ok := methodDeprecation(iface, "org.example.test.Find"); ok {
+		t.Errorf("Find: %q, %v", notice, ok)
+	}
+}
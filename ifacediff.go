@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// memberChange is a type, method or error whose signature differs
+// between two versions of an interface.
+type memberChange struct {
+	Name string `json:"name"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// memberDiff lists the members of one kind added, removed or changed
+// between two versions of an interface, by their signatures.
+type memberDiff struct {
+	Added   []string       `json:"added"`
+	Removed []string       `json:"removed"`
+	Changed []memberChange `json:"changed"`
+}
+
+func (d *memberDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+type interfaceDiff struct {
+	OldName string     `json:"old_name"`
+	NewName string     `json:"new_name"`
+	Types   memberDiff `json:"types"`
+	Methods memberDiff `json:"methods"`
+	Errors  memberDiff `json:"errors"`
+}
+
+func (d *interfaceDiff) empty() bool {
+	return d.OldName == d.NewName && d.Types.empty() && d.Methods.empty() && d.Errors.empty()
+}
+
+// signatures maps the names of the types, methods and errors of iface
+// to their signatures.
+func signatures(iface *idl.IDL) (types, methods, errors map[string]string) {
+	types = make(map[string]string)
+	for _, a := range iface.Aliases {
+		types[a.Name] = "type " + a.Name + " " + typeString(a.Type)
+	}
+	methods = make(map[string]string)
+	for _, m := range iface.Methods {
+		methods[m.Name] = "method " + m.Name + typeString(m.In) + " -> " + typeString(m.Out)
+	}
+	errors = make(map[string]string)
+	for _, e := range iface.Errors {
+		errors[e.Name] = "error " + e.Name + " " + typeString(e.Type)
+	}
+	return types, methods, errors
+}
+
+func diffMembers(old, new map[string]string) memberDiff {
+	d := memberDiff{Added: []string{}, Removed: []string{}, Changed: []memberChange{}}
+	for name, s := range old {
+		if n, ok := new[name]; !ok {
+			d.Removed = append(d.Removed, s)
+		} else if n != s {
+			d.Changed = append(d.Changed, memberChange{name, s, n})
+		}
+	}
+	for name, s := range new {
+		if _, ok := old[name]; !ok {
+			d.Added = append(d.Added, s)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Name < d.Changed[j].Name })
+	return d
+}
+
+// diffInterfaces compares the signatures of two versions of an
+// interface. Documentation comments are not compared.
+func diffInterfaces(old, new *idl.IDL) *interfaceDiff {
+	oldTypes, oldMethods, oldErrors := signatures(old)
+	newTypes, newMethods, newErrors := signatures(new)
+	return &interfaceDiff{
+		OldName: old.Name,
+		NewName: new.Name,
+		Types:   diffMembers(oldTypes, newTypes),
+		Methods: diffMembers(oldMethods, newMethods),
+		Errors:  diffMembers(oldErrors, newErrors),
+	}
+}
+
+func printInterfaceDiff(w io.Writer, d *interfaceDiff) {
+	removed := color.New(color.FgRed)
+	added := color.New(color.FgGreen)
+
+	if d.OldName != d.NewName {
+		fmt.Fprintln(w, removed.Sprintf("- interface %s", d.OldName))
+		fmt.Fprintln(w, added.Sprintf("+ interface %s", d.NewName))
+	}
+	for _, kind := range []struct {
+		title string
+		diff  *memberDiff
+	}{
+		{"Types", &d.Types},
+		{"Methods", &d.Methods},
+		{"Errors", &d.Errors},
+	} {
+		if kind.diff.empty() {
+			continue
+		}
+		fmt.Fprintln(w, bold.Sprint(kind.title))
+		for _, s := range kind.diff.Removed {
+			fmt.Fprintln(w, removed.Sprintf("- %s", s))
+		}
+		for _, s := range kind.diff.Added {
+			fmt.Fprintln(w, added.Sprintf("+ %s", s))
+		}
+		for _, c := range kind.diff.Changed {
+			fmt.Fprintln(w, removed.Sprintf("- %s", c.Old))
+			fmt.Fprintln(w, added.Sprintf("+ %s", c.New))
+		}
+	}
+}
+
+// diffInterfaceOptions are the options of diff-interface.
+type diffInterfaceOptions struct {
+	asJSON bool
+	help   bool
+}
+
+func (o *diffInterfaceOptions) flagSet() *flag.FlagSet {
+	diffFlags := flag.NewFlagSet("diff-interface", flag.ContinueOnError)
+	diffFlags.BoolVar(&o.asJSON, "json", false, "Print the added, removed and changed types, methods and errors as a JSON object")
+	diffFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return diffFlags
+}
+
+func varlinkDiffInterface(ctx context.Context, std *streams, args []string) error {
+	var o diffInterfaceOptions
+	diffFlags := o.flagSet()
+	usage := func() error {
+		return std.usage(diffFlags, "<OLD.varlink | [ADDRESS/]INTERFACE> <NEW.varlink | [ADDRESS/]INTERFACE>")
+	}
+	diffFlags.SetOutput(std.err)
+	diffFlags.Usage = func() {}
+
+	if err := diffFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || diffFlags.NArg() != 2 {
+		return usage()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var ifaces [2]*idl.IDL
+	for i, arg := range diffFlags.Args() {
+		description, err := loadDescription(ctx, std, arg)
+		if err != nil {
+			return err
+		}
+		iface, err := idl.New(description)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse interface description for '%s': %v\n", arg, err)
+		}
+		ifaces[i] = iface
+	}
+
+	d := diffInterfaces(ifaces[0], ifaces[1])
+	if o.asJSON {
+		enc := json.NewEncoder(std.out)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			return std.fail(exitFailure, "Cannot print differences: %v\n", err)
+		}
+	} else {
+		printInterfaceDiff(std.out, d)
+	}
+
+	if !d.empty() {
+		return exitError(exitDiffers)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// parseParameters converts method parameters written in the given input
+// format to the JSON sent over the wire.
+func parseParameters(parameters string, format string) (json.RawMessage, error) {
+	var value interface{}
+
+	switch format {
+	case "json":
+		var params json.RawMessage
+		if err := json.Unmarshal([]byte(parameters), &params); err != nil {
+			return nil, err
+		}
+		return params, nil
+	case "yaml":
+		if err := yaml.Unmarshal([]byte(parameters), &value); err != nil {
+			return nil, err
+		}
+	case "toml":
+		var table map[string]interface{}
+		if _, err := toml.Decode(parameters, &table); err != nil {
+			return nil, err
+		}
+		value = table
+	default:
+		return nil, fmt.Errorf("unknown input format '%s'", format)
+	}
+
+	params, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %s to JSON: %v", format, err)
+	}
+	return params, nil
+}
+
+// paramList collects repeated -param name=value flags.
+type paramList []string
+
+func (p *paramList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *paramList) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return fmt.Errorf("expected name=value, got '%s'", s)
+	}
+	*p = append(*p, s)
+	return nil
+}
+
+// inferValue interprets value as JSON if it is valid JSON, so numbers,
+// booleans, null, arrays and objects keep their type. Anything else is
+// taken as a string.
+func inferValue(value string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return value
+	}
+	return v
+}
+
+// typedValue converts value to the JSON type named by a name:type=value
+// hint: int, float, bool, string or json.
+func typedValue(typ, value string) (interface{}, error) {
+	switch typ {
+	case "int":
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an int", value)
+		}
+		return i, nil
+	case "float":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("'%s' is not a float", value)
+		}
+		return f, nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a bool", value)
+		}
+		return b, nil
+	case "string":
+		return value, nil
+	case "json":
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, fmt.Errorf("'%s' is not valid JSON: %v", value, err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown type '%s'", typ)
+}
+
+// applyParams sets each name=value of list in params. A type hint, as
+// in count:int=3 or version:string=1.0, fixes the JSON type of the
+// value instead of inferring it.
+func applyParams(params json.RawMessage, list paramList) (json.RawMessage, error) {
+	for _, p := range list {
+		kv := strings.SplitN(p, "=", 2)
+		name := kv[0]
+		value := inferValue(kv[1])
+
+		if n, typ, ok := strings.Cut(name, ":"); ok {
+			v, err := typedValue(typ, kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("parameter '%s': %v", n, err)
+			}
+			name, value = n, v
+		}
+
+		var err error
+		params, err = setParameter(params, name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// stripJSONComments removes // line comments and /* */ block comments
+// outside of strings, as found in hand written JSONC files.
+func stripJSONComments(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	inString := false
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		if inString {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out = append(out, data[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end == -1 {
+				return nil, errors.New("unterminated comment")
+			}
+			// Keep the comment separating tokens.
+			out = append(out, ' ')
+			i += 2 + end + 1
+		default:
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// headerList collects repeated -url-header "Name: value" flags.
+type headerList []string
+
+func (h *headerList) String() string {
+	return strings.Join(*h, ",")
+}
+
+func (h *headerList) Set(s string) error {
+	if !strings.Contains(s, ":") {
+		return fmt.Errorf("expected 'Name: value', got '%s'", s)
+	}
+	*h = append(*h, s)
+	return nil
+}
+
+// fetchParameters downloads the parameters from url.
+func fetchParameters(ctx context.Context, url string, timeout time.Duration, headers headerList) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range headers {
+		kv := strings.SplitN(h, ":", 2)
+		req.Header.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestApplyParams(t *testing.T) {
+	for _, tt := range []struct {
+		params string
+		list   []string
+		want   string
+		err    string
+	}{
+		// Inferred types.
+		{"", []string{"count=3"}, `{"count":3}`, ""},
+		{"", []string{"version=1.0"}, `{"version":1}`, ""},
+		{"", []string{"name=foo"}, `{"name":"foo"}`, ""},
+		{"", []string{"flag=true"}, `{"flag":true}`, ""},
+		{"", []string{"none=null"}, `{"none":null}`, ""},
+		{"", []string{`list=[1,"a"]`}, `{"list":[1,"a"]}`, ""},
+		{"", []string{"empty="}, `{"empty":""}`, ""},
+		{"", []string{"expr=a=b:c"}, `{"expr":"a=b:c"}`, ""},
+
+		// Type hints.
+		{"", []string{"count:int=3"}, `{"count":3}`, ""},
+		{"", []string{"count:int=-9223372036854775808"}, `{"count":-9223372036854775808}`, ""},
+		{"", []string{"ratio:float=1.5"}, `{"ratio":1.5}`, ""},
+		{"", []string{"ratio:float=2"}, `{"ratio":2}`, ""},
+		{"", []string{"flag:bool=true"}, `{"flag":true}`, ""},
+		{"", []string{"flag:bool=0"}, `{"flag":false}`, ""},
+		{"", []string{"name:string=3"}, `{"name":"3"}`, ""},
+		{"", []string{"version:string=1.0"}, `{"version":"1.0"}`, ""},
+		{"", []string{"name:string=true"}, `{"name":"true"}`, ""},
+		{"", []string{"name:string="}, `{"name":""}`, ""},
+		{"", []string{"url:string=http://a/?b=c"}, `{"url":"http://a/?b=c"}`, ""},
+		{"", []string{`tags:json=["a"]`}, `{"tags":["a"]}`, ""},
+		{"", []string{`obj:json={"a":1}`}, `{"obj":{"a":1}}`, ""},
+
+		// Merging with ARGUMENTS, later settings win.
+		{`{"a":1,"b":2}`, []string{"b:string=x"}, `{"a":1,"b":"x"}`, ""},
+		{"", []string{"a=1", "a:string=2"}, `{"a":"2"}`, ""},
+
+		// Errors.
+		{"", []string{"count:int=1.5"}, "", "parameter 'count': '1.5' is not an int"},
+		{"", []string{"count:int=x"}, "", "parameter 'count': 'x' is not an int"},
+		{"", []string{"count:int=99999999999999999999"}, "", "parameter 'count': '99999999999999999999' is not an int"},
+		{"", []string{"ratio:float=NaN"}, "", "parameter 'ratio': 'NaN' is not a float"},
+		{"", []string{"ratio:float=Inf"}, "", "parameter 'ratio': 'Inf' is not a float"},
+		{"", []string{"flag:bool=yes"}, "", "parameter 'flag': 'yes' is not a bool"},
+		{"", []string{"obj:json={"}, "", "parameter 'obj': '{' is not valid JSON"},
+		{"", []string{"a:date=1"}, "", "parameter 'a': unknown type 'date'"},
+		{"[1]", []string{"a=1"}, "", "parameters are not an object"},
+	} {
+		got, err := applyParams(json.RawMessage(tt.params), tt.list)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%v: got error %v, want %s", tt.list, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.list, err)
+		} else if string(got) != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestParamList(t *testing.T) {
+	var p paramList
+	if err := p.Set("a:int=1"); err != nil {
+		t.Error(err)
+	}
+	if err := p.Set("a:int"); err == nil {
+		t.Error("parameter without = accepted")
+	}
+	if p.String() != "a:int=1" {
+		t.Errorf("got %q", p.String())
+	}
+}
+
+func TestCallParam(t *testing.T) {
+	address := startTestService(t)
+
+	stdout, stderr, code := runCommand(t, "", "call", "-raw", "-param", `value:json={"v":"1.0"}`, address+"/org.example.test.Echo")
+	if code != 0 || stdout != `{"value":{"v":"1.0"}}`+"\n" {
+		t.Errorf("exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	_, stderr, code = runCommand(t, "", "call", "-param", "value:int=x", address+"/org.example.test.Echo")
+	if code == 0 || !strings.Contains(stderr, "parameter 'value': 'x' is not an int") {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+}
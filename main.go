@@ -3,230 +3,456 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/TylerBrock/colorjson"
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// Exit codes, listed in the usage and the README. exitDiffers is for
+// commands comparing replies or descriptions that found differences.
+const (
+	exitUsage      = 1
+	exitFailure    = 2
+	exitConnection = 3
+	exitDiffers    = 4
 )
 
 var (
 	bold         = color.New(color.Bold)
 	errorBoldRed string
 	bridge       string
+	debug        bool
+	stderrColor  bool
+	jsonErrors   bool
+	verbose      bool
 )
 
-func errPrintf(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, "%s ", errorBoldRed)
-	fmt.Fprintf(os.Stderr, format, a...)
+// streams are the standard streams a command reads and writes, those
+// of the process when run by main.
+type streams struct {
+	in  io.Reader
+	out io.Writer
+	err io.Writer
+
+	// pendingError is the error held back with -json-errors.
+	pendingError *errorReport
+}
+
+// exitError ends a command with an exit code. The command has already
+// printed why.
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// exitCode returns the exit code for the error a command returned.
+func exitCode(err error) int {
+	var e exitError
+	if errors.As(err, &e) {
+		return int(e)
+	}
+	if err != nil {
+		return exitFailure
+	}
+	return 0
 }
 
-func printUsage(set *flag.FlagSet, arg_help string) {
+// errColor returns a color for output to stderr.
+func errColor(value ...color.Attribute) *color.Color {
+	c := color.New(value...)
+	if stderrColor {
+		c.EnableColor()
+	} else {
+		c.DisableColor()
+	}
+	return c
+}
+
+func (std *streams) errorf(format string, a ...interface{}) {
+	if jsonErrors {
+		std.flushError(nil)
+		std.pendingError = &errorReport{Error: strings.TrimSpace(fmt.Sprintf(format, a...))}
+		return
+	}
+	fmt.Fprintf(std.err, "%s ", errorBoldRed)
+	fmt.Fprintf(std.err, format, a...)
+}
+
+// fail prints an error and returns the exitError ending the command
+// with code.
+func (std *streams) fail(code int, format string, a ...interface{}) error {
+	std.errorf(format, a...)
+	return exitError(code)
+}
+
+// errorReport is an error printed to stderr with -json-errors. The
+// exit code is only known once the command returns, so the last error
+// is held back until then or until the next one comes along.
+type errorReport struct {
+	Error      string           `json:"error"`
+	Name       string           `json:"name,omitempty"`
+	Parameters *json.RawMessage `json:"parameters,omitempty"`
+	Causes     []string         `json:"causes,omitempty"`
+	ExitCode   *int             `json:"exit_code,omitempty"`
+}
+
+// flushError prints the held back error, if any, with exitCode.
+func (std *streams) flushError(exitCode *int) {
+	if std.pendingError == nil {
+		return
+	}
+	std.pendingError.ExitCode = exitCode
+	b, _ := json.Marshal(std.pendingError)
+	fmt.Fprintln(std.err, string(b))
+	std.pendingError = nil
+}
+
+// printCauses prints the errors err wraps, each under the one wrapping
+// it, with -verbose.
+func (std *streams) printCauses(err error) {
+	if !verbose {
+		return
+	}
+	indent := "  "
+	for err = errors.Unwrap(err); err != nil; err = errors.Unwrap(err) {
+		if jsonErrors {
+			std.pendingError.Causes = append(std.pendingError.Causes, err.Error())
+		} else {
+			fmt.Fprintf(std.err, "%scaused by: %v\n", indent, err)
+		}
+		indent += "  "
+	}
+}
+
+// usage prints the usage of the command with the flag set, or of the
+// tool if set is nil, and returns the usage exit code.
+func (std *streams) usage(set *flag.FlagSet, argHelp string) error {
 	if set == nil {
-		fmt.Fprintf(os.Stderr, "Usage: %s [GLOBAL OPTIONS] COMMAND ...\n", os.Args[0])
+		fmt.Fprintf(std.err, "Usage: %s [GLOBAL OPTIONS] COMMAND ...\n", os.Args[0])
 	} else {
-		fmt.Fprintf(os.Stderr, "Usage: %s [GLOBAL OPTIONS] %s [OPTIONS] %s\n", os.Args[0], set.Name(), arg_help)
+		fmt.Fprintf(std.err, "Usage: %s [GLOBAL OPTIONS] %s [OPTIONS] %s\n", os.Args[0], set.Name(), argHelp)
 	}
 
-	fmt.Fprintln(os.Stderr, "\nGlobal Options:")
+	fmt.Fprintln(std.err, "\nGlobal Options:")
+	flag.CommandLine.SetOutput(std.err)
 	flag.PrintDefaults()
 
 	if set == nil {
-		fmt.Fprintln(os.Stderr, "\nCommands:")
-		fmt.Fprintln(os.Stderr, "  info\tPrint information about a service")
-		fmt.Fprintln(os.Stderr, "  help\tPrint interface description or service information")
-		fmt.Fprintln(os.Stderr, "  call\tCall a method")
+		fmt.Fprintln(std.err, "\nCommands:")
+		fmt.Fprintln(std.err, "  info, i\tPrint information about a service")
+		fmt.Fprintln(std.err, "  help, h\tPrint interface description or service information")
+		fmt.Fprintln(std.err, "  call, c\tCall a method")
+		fmt.Fprintln(std.err, "  dump\tPrint the descriptions of all interfaces of a service")
+		fmt.Fprintln(std.err, "  agent\tStart, run or stop the connection agent")
+		fmt.Fprintln(std.err, "  diff\tCompare the replies of two method calls")
+		fmt.Fprintln(std.err, "  call-each\tCall a method once for each line of a CSV file")
+		fmt.Fprintln(std.err, "  chain\tCall methods in sequence, passing each reply on to the next call")
+		fmt.Fprintln(std.err, "  run\tCall the method described by an invocation file")
+		fmt.Fprintln(std.err, "  errors\tList the errors an interface declares")
+		fmt.Fprintln(std.err, "  services\tList the interfaces known to the resolver and their addresses")
+		fmt.Fprintln(std.err, "  monitor\tWatch a service and report when it goes up or down")
+		fmt.Fprintln(std.err, "  bench\tMeasure the latency of repeated method calls")
+		fmt.Fprintln(std.err, "  serve-mock\tAnswer method calls with canned replies from a file")
+		fmt.Fprintln(std.err, "  record\tSave a method call and its reply to a file")
+		fmt.Fprintln(std.err, "  replay\tRepeat a recorded call and compare the replies")
+		fmt.Fprintln(std.err, "  format\tPrint saved replies formatted like call does")
+		fmt.Fprintln(std.err, "  doc\tPrint the documentation of an interface as markdown")
+		fmt.Fprintln(std.err, "  replay-frames\tPrint or repeat messages captured with -debug-frames")
+		fmt.Fprintln(std.err, "  diff-interface\tCompare the types, methods and errors of two interface descriptions")
+
+		fmt.Fprintln(std.err, "\nExit Codes:")
+		fmt.Fprintln(std.err, "  1\tUsage error")
+		fmt.Fprintln(std.err, "  2\tFailure, like an error reply")
+		fmt.Fprintln(std.err, "  3\tCannot connect, or the connection closed before the reply was complete")
+		fmt.Fprintln(std.err, "  4\tDifferences found by diff, diff-interface, replay, replay-frames or call -expect")
 	} else {
-		fmt.Fprintln(os.Stderr, "\nOptions:")
+		fmt.Fprintln(std.err, "\nOptions:")
+		set.SetOutput(std.err)
 		set.PrintDefaults()
 	}
-	os.Exit(1)
+	return exitError(exitUsage)
+}
+
+// helpOptions are the options of help.
+type helpOptions struct {
+	interfaceVersion string
+	docs             bool
+	forcePager       bool
+	signatures       bool
+	noPager          bool
+	help             bool
+}
+
+func (o *helpOptions) flagSet() *flag.FlagSet {
+	helpFlags := flag.NewFlagSet("help", flag.ContinueOnError)
+	helpFlags.StringVar(&o.interfaceVersion, "interface-version", "", "Describe this version of the interface")
+	helpFlags.BoolVar(&o.docs, "docs", false, "Print only the documentation comments")
+	helpFlags.BoolVar(&o.signatures, "signatures", false, "Print only the method signatures, one per line")
+	helpFlags.BoolVar(&o.forcePager, "pager", false, "Always show the output with $PAGER if stdout is a terminal")
+	helpFlags.BoolVar(&o.noPager, "no-pager", false, "Do not show long output with $PAGER")
+	helpFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return helpFlags
 }
 
-func varlinkCall(ctx context.Context, args []string) {
+func varlinkHelp(ctx context.Context, std *streams, args []string) error {
 	var err error
-	var oneway bool
 
-	callFlags := flag.NewFlagSet("help", flag.ExitOnError)
-	callFlags.BoolVar(&oneway, "-oneway", false, "Use bridge for connection")
-	var help bool
-	callFlags.BoolVar(&help, "help", false, "Prints help information")
-	usage := func() { printUsage(callFlags, "<[ADDRESS/]INTERFACE.METHOD> [ARGUMENTS]") }
-	callFlags.Usage = usage
+	var o helpOptions
+	helpFlags := o.flagSet()
+	usage := func() error { return std.usage(helpFlags, "<[ADDRESS/]INTERFACE>") }
+	helpFlags.SetOutput(std.err)
+	helpFlags.Usage = func() {}
 
-	_ = callFlags.Parse(args)
+	if err := helpFlags.Parse(args); err != nil {
+		return usage()
+	}
 
-	if help {
-		usage()
+	if o.help {
+		return usage()
 	}
 
-	var con *varlink.Connection
-	var methodName string
+	if o.docs && o.signatures {
+		std.errorf("-docs cannot be combined with -signatures\n\n")
+		return usage()
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	var con *varlink.Connection
+	var interfaceName string
+	var address string
+
 	if len(bridge) != 0 {
-		con, err = varlink.NewBridge(bridge)
+		interfaceName = helpFlags.Arg(0)
+		if err := allowInterface(std, calledInterface(interfaceName, o.interfaceVersion)); err != nil {
+			return err
+		}
+		con, err = connectBridge(ctx, std)
+		if err != nil {
+			return std.fail(exitConnection, "Cannot connect with bridge '%s': %v\n", bridge, err)
+		}
+	} else if useActivation(helpFlags.Arg(0)) {
+		interfaceName = helpFlags.Arg(0)
+		if err := allowInterface(std, calledInterface(interfaceName, o.interfaceVersion)); err != nil {
+			return err
+		}
+		con, err = connectActivation(ctx, std)
 		if err != nil {
-			errPrintf("Cannot connect with bridge '%s': %v\n", bridge, err)
-			os.Exit(2)
+			return std.fail(exitConnection, "Cannot connect with socket activation: %v\n", err)
 		}
-		methodName = callFlags.Arg(0)
 	} else {
-		uri := callFlags.Arg(0)
-		if uri == "" {
-			usage()
+		uri := helpFlags.Arg(0)
+		if uri == "" && bridge == "" {
+			std.errorf("No ADDRESS or activation or bridge\n\n")
+			return usage()
 		}
 
-		li := strings.LastIndex(uri, "/")
-
-		if li == -1 {
-			errPrintf("Invalid address '%s'\n", uri)
-			os.Exit(2)
+		if li := strings.LastIndex(uri, "/"); li != -1 {
+			address = uri[:li]
+			interfaceName = uri[li+1:]
+			if err := allowInterface(std, calledInterface(interfaceName, o.interfaceVersion)); err != nil {
+				return err
+			}
+		} else {
+			interfaceName = uri
+			if err := allowInterface(std, calledInterface(interfaceName, o.interfaceVersion)); err != nil {
+				return err
+			}
+			address, err = resolveAddress(ctx, std, interfaceName)
+			if err != nil {
+				return std.fail(exitConnection, "Cannot resolve interface '%s': %v\n", interfaceName, err)
+			}
 		}
 
-		address := uri[:li]
-		methodName = uri[li+1:]
-
-		con, err = varlink.NewConnection(ctx, address)
+		con, err = connect(ctx, std, address)
 		if err != nil {
-			errPrintf("Cannot connect to '%s': %v\n", address, err)
-			os.Exit(2)
+			std.errorf("Cannot connect to '%s': %v\n", address, err)
+			std.printCauses(err)
+			return exitError(exitConnection)
 		}
 	}
-	var parameters string
-	var params json.RawMessage
-
-	parameters = callFlags.Arg(1)
-	if parameters == "" {
-		params = nil
-	} else {
-		if err := json.Unmarshal([]byte(parameters), &params); err != nil {
-			errPrintf("Cannot parse parameters: %v\n", err)
-			os.Exit(2)
+	if o.interfaceVersion != "" {
+		if err := checkInterfaceVersion(ctx, con, interfaceName, o.interfaceVersion); err != nil {
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Cannot get interface description for '%s': %v\n", interfaceName, err)
 		}
+		interfaceName = calledInterface(interfaceName, o.interfaceVersion)
 	}
 
-	var flags uint64
-	flags = 0
-	if oneway {
-		flags |= varlink.Oneway
-	}
-	recv, err := con.Send(ctx, methodName, params, flags)
+	description, err := describeInterface(ctx, std, con, address, interfaceName)
 	if err != nil {
-		errPrintf("Error calling '%s': %v\n", methodName, err)
-		os.Exit(2)
+		if err := notVarlink(std, err, address); err != nil {
+			return err
+		}
+		return std.fail(exitFailure, "Cannot get interface description for '%s': %v\n", interfaceName, err)
 	}
 
-	var retval map[string]interface{}
+	if o.docs || o.signatures {
+		iface, err := idl.New(description)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse interface description for '%s': %v\n", interfaceName, err)
+		}
+		var b strings.Builder
+		if o.docs {
+			printDocs(&b, iface)
+		} else {
+			printSignatures(&b, iface)
+		}
+		description = b.String()
+	} else {
+		description += "\n"
+	}
 
-	// FIXME: Use cont
-	_, err = recv(ctx, &retval)
+	if o.noPager {
+		fmt.Fprint(std.out, description)
+		return nil
+	}
+	page(std, description, o.forcePager)
+	return nil
+}
 
-	f := colorjson.NewFormatter()
-	f.Indent = 2
-	f.KeyColor = color.New(color.FgCyan)
-	f.StringColor = color.New(color.FgMagenta)
-	f.NumberColor = color.New(color.FgMagenta)
-	f.BoolColor = color.New(color.FgMagenta)
-	f.NullColor = color.New(color.FgMagenta)
+// infoOptions are the options of info.
+type infoOptions struct {
+	tree    bool
+	compact bool
+	help    bool
+}
 
-	if err != nil {
-		if e, ok := err.(*varlink.Error); ok {
-			errPrintf("Call failed with error: %v\n", color.New(color.FgRed).Sprint(e.Name))
-			errorRawParameters := e.Parameters.(*json.RawMessage)
-			if errorRawParameters != nil {
-				var param map[string]interface{}
-				_ = json.Unmarshal(*errorRawParameters, &param)
-				c, _ := f.Marshal(param)
-				fmt.Fprintf(os.Stderr, "%v\n", string(c))
-			}
-			os.Exit(2)
-		}
-		errPrintf("Error calling '%s': %v\n", methodName, err)
-		os.Exit(2)
-	}
-	c, _ := f.Marshal(retval)
-	fmt.Println(string(c))
+func (o *infoOptions) flagSet() *flag.FlagSet {
+	infoFlags := flag.NewFlagSet("info", flag.ContinueOnError)
+	infoFlags.BoolVar(&o.tree, "tree", false, "Print the interfaces as a tree grouped by name prefix")
+	infoFlags.BoolVar(
+		&o.compact,
+		"compact",
+		false,
+		"Print vendor, product, version, url and the interfaces one per line without labels",
+	)
+	infoFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return infoFlags
 }
 
-func varlinkHelp(ctx context.Context, args []string) {
+func varlinkInfo(ctx context.Context, std *streams, args []string) error {
 	var err error
 
-	helpFlags := flag.NewFlagSet("help", flag.ExitOnError)
-	var help bool
-	helpFlags.BoolVar(&help, "help", false, "Prints help information")
-	usage := func() { printUsage(helpFlags, "<[ADDRESS/]INTERFACE>") }
-	helpFlags.Usage = usage
+	var o infoOptions
+	infoFlags := o.flagSet()
+	usage := func() error { return std.usage(infoFlags, "[ADDRESS]") }
+	infoFlags.SetOutput(std.err)
+	infoFlags.Usage = func() {}
 
-	_ = helpFlags.Parse(args)
+	if err := infoFlags.Parse(args); err != nil {
+		return usage()
+	}
 
-	if help {
-		usage()
+	if o.help {
+		return usage()
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-
 	var con *varlink.Connection
-	var interfaceName string
+	var address string
 
 	if len(bridge) != 0 {
-		con, err = varlink.NewBridge(bridge)
+		con, err = connectBridge(ctx, std)
 		if err != nil {
-			errPrintf("Cannot connect with bridge '%s': %v\n", bridge, err)
-			os.Exit(2)
+			return std.fail(exitConnection, "Cannot connect with bridge '%s': %v\n", bridge, err)
 		}
-		interfaceName = helpFlags.Arg(0)
-	} else {
-		uri := helpFlags.Arg(0)
-		if uri == "" && bridge == "" {
-			errPrintf("No ADDRESS or activation or bridge\n\n")
-			usage()
+		address = "bridge:" + bridge
+	} else if infoFlags.Arg(0) == "" && activated() {
+		con, err = connectActivation(ctx, std)
+		if err != nil {
+			return std.fail(exitConnection, "Cannot connect with socket activation: %v\n", err)
 		}
+		address = "activation"
+	} else {
+		address = infoFlags.Arg(0)
 
-		li := strings.LastIndex(uri, "/")
+		if address == "" && bridge == "" {
+			std.errorf("No ADDRESS or activation or bridge\n\n")
+			return usage()
+		}
 
-		if li == -1 {
-			errPrintf("Invalid address '%s'\n", uri)
-			os.Exit(2)
+		con, err = connect(ctx, std, address)
+		if err != nil {
+			std.errorf("Cannot connect to '%s': %v\n", address, err)
+			std.printCauses(err)
+			return exitError(exitConnection)
 		}
+	}
 
-		address := uri[:li]
+	var vendor, product, version, url string
+	var interfaces []string
 
-		con, err = varlink.NewConnection(ctx, address)
-		if err != nil {
-			errPrintf("Cannot connect to '%s': %v\n", address, err)
-			os.Exit(2)
+	err = con.GetInfo(ctx, &vendor, &product, &version, &url, &interfaces)
+	if err != nil {
+		if err := notVarlink(std, err, address); err != nil {
+			return err
 		}
+		return std.fail(exitFailure, "Cannot get info for '%s': %v\n", address, err)
+	}
 
-		interfaceName = uri[li+1:]
+	if o.compact {
+		fmt.Fprintf(std.out, "%s\n%s\n%s\n%s\n", vendor, product, version, url)
+		for _, i := range interfaces {
+			fmt.Fprintln(std.out, i)
+		}
+		return nil
 	}
-	description, err := con.GetInterfaceDescription(ctx, interfaceName)
-	if err != nil {
-		errPrintf("Cannot get interface description for '%s': %v\n", interfaceName, err)
-		os.Exit(2)
+
+	fmt.Fprintf(std.out, "%s %s\n", bold.Sprint("Vendor:"), vendor)
+	fmt.Fprintf(std.out, "%s %s\n", bold.Sprint("Product:"), product)
+	fmt.Fprintf(std.out, "%s %s\n", bold.Sprint("Version:"), version)
+	fmt.Fprintf(std.out, "%s %s\n", bold.Sprint("URL:"), url)
+	if o.tree {
+		fmt.Fprintf(std.out, "%s\n%s", bold.Sprint("Interfaces:"), interfaceTree(interfaces, "  "))
+		return nil
 	}
+	fmt.Fprintf(std.out, "%s\n  %s\n", bold.Sprint("Interfaces:"), strings.Join(interfaces[:], "\n  "))
+	return nil
+}
 
-	fmt.Println(description)
+// dumpOptions are the options of dump.
+type dumpOptions struct {
+	asJSON bool
+	help   bool
 }
 
-func varlinkInfo(ctx context.Context, args []string) {
+func (o *dumpOptions) flagSet() *flag.FlagSet {
+	dumpFlags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	dumpFlags.BoolVar(&o.asJSON, "json", false, "Print a JSON object mapping interface names to descriptions")
+	dumpFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return dumpFlags
+}
+
+func varlinkDump(ctx context.Context, std *streams, args []string) error {
 	var err error
-	infoFlags := flag.NewFlagSet("info", flag.ExitOnError)
-	var help bool
-	infoFlags.BoolVar(&help, "help", false, "Prints help information")
-	usage := func() { printUsage(infoFlags, "[ADDRESS]") }
-	infoFlags.Usage = usage
 
-	_ = infoFlags.Parse(args)
+	var o dumpOptions
+	dumpFlags := o.flagSet()
+	usage := func() error { return std.usage(dumpFlags, "[ADDRESS]") }
+	dumpFlags.SetOutput(std.err)
+	dumpFlags.Usage = func() {}
+
+	if err := dumpFlags.Parse(args); err != nil {
+		return usage()
+	}
 
-	if help {
-		usage()
+	if o.help {
+		return usage()
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -235,75 +461,276 @@ func varlinkInfo(ctx context.Context, args []string) {
 	var address string
 
 	if len(bridge) != 0 {
-		con, err = varlink.NewBridge(bridge)
+		con, err = connectBridge(ctx, std)
 		if err != nil {
-			errPrintf("Cannot connect with bridge '%s': %v\n", bridge, err)
-			os.Exit(2)
+			return std.fail(exitConnection, "Cannot connect with bridge '%s': %v\n", bridge, err)
 		}
 		address = "bridge:" + bridge
+	} else if dumpFlags.Arg(0) == "" && activated() {
+		con, err = connectActivation(ctx, std)
+		if err != nil {
+			return std.fail(exitConnection, "Cannot connect with socket activation: %v\n", err)
+		}
+		address = "activation"
 	} else {
-		address = infoFlags.Arg(0)
+		address = dumpFlags.Arg(0)
 
-		if address == "" && bridge == "" {
-			errPrintf("No ADDRESS or activation or bridge\n\n")
-			usage()
+		if address == "" {
+			std.errorf("No ADDRESS or activation or bridge\n\n")
+			return usage()
 		}
 
-		con, err = varlink.NewConnection(ctx, address)
+		con, err = connect(ctx, std, address)
 		if err != nil {
-			errPrintf("Cannot connect to '%s': %v\n", address, err)
-			os.Exit(2)
+			std.errorf("Cannot connect to '%s': %v\n", address, err)
+			std.printCauses(err)
+			return exitError(exitConnection)
 		}
 	}
 
-	var vendor, product, version, url string
 	var interfaces []string
 
-	err = con.GetInfo(ctx, &vendor, &product, &version, &url, &interfaces)
+	err = con.GetInfo(ctx, nil, nil, nil, nil, &interfaces)
 	if err != nil {
-		errPrintf("Cannot get info for '%s': %v\n", address, err)
-		os.Exit(2)
+		if err := notVarlink(std, err, address); err != nil {
+			return err
+		}
+		return std.fail(exitFailure, "Cannot get info for '%s': %v\n", address, err)
+	}
+
+	// Interfaces not allowed by -allow-interfaces are left out.
+	allowed := interfaces[:0]
+	for _, name := range interfaces {
+		if interfaceAllowed(name) {
+			allowed = append(allowed, name)
+		}
+	}
+	interfaces = allowed
+
+	descriptions := make(map[string]interface{}, len(interfaces))
+	for i, name := range interfaces {
+		description, err := con.GetInterfaceDescription(ctx, name)
+		if err != nil {
+			if err := notVarlink(std, err, address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Cannot get interface description for '%s': %v\n", name, err)
+		}
+
+		if o.asJSON {
+			descriptions[name] = description
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(std.out)
+		}
+		fmt.Fprintln(std.out, description)
+	}
+
+	if o.asJSON {
+		c, _ := newFormatter().Marshal(descriptions)
+		fmt.Fprintln(std.out, string(c))
 	}
+	return nil
+}
 
-	fmt.Printf("%s %s\n", bold.Sprint("Vendor:"), vendor)
-	fmt.Printf("%s %s\n", bold.Sprint("Product:"), product)
-	fmt.Printf("%s %s\n", bold.Sprint("Version:"), version)
-	fmt.Printf("%s %s\n", bold.Sprint("URL:"), url)
-	fmt.Printf("%s\n  %s\n\n", bold.Sprint("Interfaces:"), strings.Join(interfaces[:], "\n  "))
+// commands are the commands of the tool, in the order of the usage.
+var commands = []struct {
+	name  string
+	alias string
+	run   func(context.Context, *streams, []string) error
+	// flags returns a new flag set of the command, for describeFlags.
+	flags func() *flag.FlagSet
+}{
+	{"info", "i", varlinkInfo, new(infoOptions).flagSet},
+	{"help", "h", varlinkHelp, new(helpOptions).flagSet},
+	{"call", "c", varlinkCall, new(callOptions).flagSet},
+	{"dump", "", varlinkDump, new(dumpOptions).flagSet},
+	{"agent", "", varlinkAgent, new(agentOptions).flagSet},
+	{"diff", "", varlinkDiff, new(diffOptions).flagSet},
+	{"call-each", "", varlinkCallEach, new(callEachOptions).flagSet},
+	{"chain", "", varlinkChain, new(chainOptions).flagSet},
+	{"run", "", varlinkRun, new(runOptions).flagSet},
+	{"errors", "", varlinkErrors, new(errorsOptions).flagSet},
+	{"services", "", varlinkServices, new(servicesOptions).flagSet},
+	{"monitor", "", varlinkMonitor, new(monitorOptions).flagSet},
+	{"bench", "", varlinkBench, new(benchOptions).flagSet},
+	{"serve-mock", "", varlinkServeMock, new(serveMockOptions).flagSet},
+	{"record", "", varlinkRecord, new(recordOptions).flagSet},
+	{"replay", "", varlinkReplay, new(replayOptions).flagSet},
+	{"format", "", varlinkFormat, new(formatOptions).flagSet},
+	{"doc", "", varlinkDoc, new(docOptions).flagSet},
+	{"replay-frames", "", varlinkReplayFrames, new(replayFramesOptions).flagSet},
+	{"diff-interface", "", varlinkDiffInterface, new(diffInterfaceOptions).flagSet},
 }
 
 func main() {
-	var debug bool
 	var colorMode string
+	var noStderrColor bool
+	var timeout time.Duration
+	var deadline string
+	var retryOnList string
+	var allowList string
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	flag.CommandLine.Usage = func() { printUsage(nil, "") }
+	std := &streams{in: os.Stdin, out: os.Stdout, err: os.Stderr}
+	flag.CommandLine.Usage = func() { exitMain(std, std.usage(nil, "")) }
 	flag.BoolVar(&debug, "debug", false, "Enable debug output")
 	flag.StringVar(&bridge, "bridge", "", "Use bridge for connection")
+	flag.StringVar(&connectVia, "connect-via", "", "Speak varlink over the standard input and output of this shell command")
 	flag.StringVar(
 		&colorMode,
 		"color",
 		"auto",
 		"colorize output [default: auto]  [possible values: on, off, auto]",
 	)
+	flag.BoolVar(&noStderrColor, "no-stderr-color", false, "Do not colorize messages on stderr")
+	flag.BoolVar(&interfaceCache, "interface-cache", false, "Cache interface descriptions on disk, per address and service version")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 10*time.Minute, "Time for which interface descriptions cached with -interface-cache are used")
+	flag.BoolVar(&verbose, "verbose", false, "Print the underlying causes of connection errors")
+	flag.BoolVar(&jsonErrors, "json-errors", false, "Print errors to stderr as JSON objects including the exit code")
+	flag.StringVar(&agentSocket, "agent-socket", defaultAgentSocket(), "Socket of the connection agent used by call")
+	flag.IntVar(&connectRetries, "connect-retries", 0, "Number of times to retry a failed connection")
+	flag.DurationVar(&retryInterval, "retry-interval", 500*time.Millisecond, "Time to wait between connection retries")
+	flag.Var(&retryJitter, "retry-jitter", "Randomly shorten each retry wait by up to this fraction of -retry-interval, 1 if given without a value")
+	flag.DurationVar(&keepAlive, "keepalive", 0, "Interval of TCP keep-alive probes on tcp: and WebSocket connections")
+	flag.BoolVar(&debugFrames, "debug-frames", false, "Print every message sent and received on unix:, tcp: and WebSocket connections to stderr")
+	flag.BoolVar(&tracing, "trace", false, "Print a timeline of resolving, connecting, sending and receiving to stderr")
+	flag.BoolVar(&followRedirects, "follow-redirects", false, "Ask again if the resolver answers with the address of another resolver")
+	flag.BoolVar(&noResolver, "no-resolver", false, "Require an ADDRESS instead of asking the varlink resolver for it")
+	flag.DurationVar(&timeout, "timeout", 0, "Give up if the command did not finish within this time")
+	flag.StringVar(&deadline, "deadline", "", "Give up if the command did not finish by this RFC 3339 time")
+	flag.StringVar(
+		&retryOnList,
+		"retry-on",
+		"",
+		"Only retry connection errors matching these conditions [possible values: connrefused, notfound, timeout, dns]",
+	)
+
+	flag.DurationVar(&pollConnect, "poll-connect", 0, "Wait up to this long for the socket file of a unix: address to appear")
+	flag.DurationVar(&stdinTimeout, "stdin-timeout", 0, "Fail if no input arrives on stdin within this time, for commands reading it")
+	flag.StringVar(&allowList, "allow-interfaces", "", "Refuse to call or describe interfaces not in this comma separated list")
 
 	flag.Parse()
+	traceStart = time.Now()
 
-	if colorMode != "on" && (os.Getenv("TERM") == "" || colorMode == "off") {
-		color.NoColor = true // disables colorized output
+	if allowList != "" {
+		allowedInterfaces = parseInterfaceList(allowList)
+	}
+
+	setupColor(std, colorMode, noStderrColor)
+
+	var err error
+	if retryOn, err = parseRetryOn(retryOnList); err != nil {
+		std.errorf("Invalid -retry-on: %v\n\n", err)
+		exitMain(std, std.usage(nil, ""))
+	}
+	if len(retryOn) > 0 && connectRetries == 0 {
+		// -retry-on only narrows down which failures -connect-retries
+		// retries, alone it would silently do nothing.
+		std.errorf("-retry-on requires -connect-retries\n\n")
+		exitMain(std, std.usage(nil, ""))
+	}
+
+	if connectVia != "" {
+		if bridge != "" {
+			std.errorf("-connect-via cannot be combined with -bridge\n\n")
+			exitMain(std, std.usage(nil, ""))
+		}
+		// The commands handle -connect-via like -bridge.
+		bridge = connectVia
+	}
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if deadline != "" {
+		t, err := time.Parse(time.RFC3339, deadline)
+		if err != nil {
+			std.errorf("Invalid -deadline: %v\n\n", err)
+			exitMain(std, std.usage(nil, ""))
+		}
+		if !t.After(time.Now()) {
+			exitMain(std, std.fail(exitFailure, "-deadline %s is in the past\n", deadline))
+		}
+		ctx, cancel = context.WithDeadline(ctx, t)
+		defer cancel()
 	}
 
-	errorBoldRed = bold.Sprint(color.New(color.FgRed).Sprint("Error:"))
+	exitMain(std, run(ctx, std, flag.Args()))
+}
+
+// isTerminal reports whether f is a terminal.
+var isTerminal = func(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// setupColor turns colors on stdout and stderr on or off for -color and
+// -no-stderr-color.
+func setupColor(std *streams, colorMode string, noStderrColor bool) {
+	switch {
+	case colorMode == "on":
+		// The color package turns colors off when stdout is not a
+		// terminal, but "on" is meant to force them, e.g. for less -R.
+		color.NoColor = false
+	case colorMode == "off" || os.Getenv("TERM") == "":
+		color.NoColor = true // disables colorized output
+	}
 
-	switch flag.Arg(0) {
-	case "info":
-		varlinkInfo(ctx, flag.Args()[1:])
-	case "help":
-		varlinkHelp(ctx, flag.Args()[1:])
-	case "call":
-		varlinkCall(ctx, flag.Args()[1:])
+	// Like the color package does for stdout, only colorize stderr if
+	// it is a terminal and NO_COLOR is not set.
+	switch {
+	case noStderrColor || colorMode == "off" || jsonErrors:
+		stderrColor = false
+	case colorMode == "on":
+		stderrColor = true
 	default:
-		printUsage(nil, "")
+		f, ok := std.err.(*os.File)
+		stderrColor = os.Getenv("TERM") != "" && os.Getenv("TERM") != "dumb" && os.Getenv("NO_COLOR") == "" &&
+			ok && isTerminal(f)
+	}
+
+	errorBoldRed = errColor(color.Bold, color.FgRed).Sprint("Error:")
+}
+
+// run runs the command named by args[0] with the remaining arguments.
+func run(ctx context.Context, std *streams, args []string) (err error) {
+	defer closeBridge()
+	defer func() {
+		var e exitError
+		if err != nil && !errors.As(err, &e) {
+			std.errorf("%v\n", err)
+		}
+		// An error that did not end the command leaves it with exit
+		// code 0.
+		code := exitCode(err)
+		std.flushError(&code)
+		if err != nil {
+			reportCommand(std)
+		}
+	}()
+
+	if len(args) == 0 {
+		return std.usage(nil, "")
 	}
+	if args[0] == "__describe-flags" {
+		return describeFlags(std)
+	}
+	for _, c := range commands {
+		if args[0] == c.name || (c.alias != "" && args[0] == c.alias) {
+			return c.run(ctx, std, args[1:])
+		}
+	}
+	return std.usage(nil, "")
+}
+
+// exitMain ends the tool with the exit code for err, printing the held
+// back -json-errors error with it.
+func exitMain(std *streams, err error) {
+	code := exitCode(err)
+	std.flushError(&code)
+	os.Exit(code)
 }
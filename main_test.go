@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/varlink/go/varlink"
+)
+
+const testDescription = `# Interface of the test service.
+interface org.example.test
+
+# Replies with the parameters of the call.
+method Echo(value: ?object) -> (value: ?object)
+
+# Replies with n counting from 1 to count, one reply each with more.
+method Count(count: int) -> (n: int)
+
+# Always fails with NotHere.
+method Fail() -> ()
+
+error NotHere (code: int)
+`
+
+// testInterface implements org.example.test for the tests.
+type testInterface struct{}
+
+func (testInterface) VarlinkGetName() string {
+	return "org.example.test"
+}
+
+func (testInterface) VarlinkGetDescription() string {
+	return testDescription
+}
+
+func (testInterface) VarlinkDispatch(ctx context.Context, c varlink.Call, methodname string) error {
+	switch methodname {
+	case "Echo":
+		if c.In.Parameters == nil {
+			return c.Reply(ctx, nil)
+		}
+		return c.Reply(ctx, c.In.Parameters)
+	case "Count":
+		var in struct {
+			Count int `json:"count"`
+		}
+		if err := c.GetParameters(&in); err != nil {
+			return c.ReplyInvalidParameter(ctx, "count")
+		}
+		for n := 1; n <= in.Count; n++ {
+			c.Continues = c.WantsMore() && n < in.Count
+			if err := c.Reply(ctx, map[string]int{"n": n}); err != nil {
+				return err
+			}
+			if !c.WantsMore() {
+				break
+			}
+		}
+		return nil
+	case "Fail":
+		return c.ReplyError(ctx, "org.example.test.NotHere", map[string]int{"code": 3})
+	}
+	return c.ReplyMethodNotFound(ctx, methodname)
+}
+
+// startTestService serves org.example.test on a unix socket until the
+// test ends and returns its address.
+func startTestService(t testing.TB) string {
+	t.Helper()
+
+	address := "unix:" + filepath.Join(t.TempDir(), "test.sock")
+	serveTest(t, address)
+	return address
+}
+
+// serveTest serves org.example.test on address until the test ends.
+func serveTest(t testing.TB, address string) {
+	t.Helper()
+
+	service, err := varlink.NewService("Varlink", "Test", "1", "https://varlink.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.RegisterInterface(testInterface{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := service.Bind(ctx, address); err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		_ = service.DoListen(ctx, 0)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		_ = service.Shutdown()
+		<-done
+	})
+}
+
+// runCommand runs a command of the tool with stdin as its input and
+// returns what it printed and its exit code.
+func runCommand(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	std := &streams{in: strings.NewReader(stdin), out: &stdout, err: &stderr}
+	err := run(context.Background(), std, args)
+	return stdout.String(), stderr.String(), exitCode(err)
+}
+
+func TestRunCall(t *testing.T) {
+	address := startTestService(t)
+
+	stdout, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Echo", `{"value": {"a": 1}}`)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	want := "{\n  \"value\": {\n    \"a\": 1\n  }\n}\n"
+	if stdout != want {
+		t.Errorf("stdout %q, want %q", stdout, want)
+	}
+}
+
+func TestRunCallError(t *testing.T) {
+	address := startTestService(t)
+
+	stdout, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Fail")
+	if code != exitFailure {
+		t.Errorf("exit code %d, want %d", code, exitFailure)
+	}
+	if stdout != "" {
+		t.Errorf("stdout %q, want nothing", stdout)
+	}
+	if !strings.Contains(stderr, "org.example.test.NotHere") {
+		t.Errorf("stderr %q does not name the error", stderr)
+	}
+}
+
+func TestRunJSONErrors(t *testing.T) {
+	address := startTestService(t)
+	defer func(v bool) { jsonErrors = v }(jsonErrors)
+	jsonErrors = true
+
+	_, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Fail")
+	if code != exitFailure {
+		t.Errorf("exit code %d, want %d", code, exitFailure)
+	}
+
+	var report errorReport
+	if err := json.Unmarshal([]byte(stderr), &report); err != nil {
+		t.Fatalf("stderr %q is not a JSON error: %v", stderr, err)
+	}
+	if report.Name != "org.example.test.NotHere" {
+		t.Errorf("name %q, want org.example.test.NotHere", report.Name)
+	}
+	if report.ExitCode == nil || *report.ExitCode != exitFailure {
+		t.Errorf("exit_code %v, want %d", report.ExitCode, exitFailure)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"no-such-command"},
+		{"call", "-no-such-flag"},
+		{"call", "-more", "-oneway", "unix:/nowhere/org.example.test.Echo"},
+	} {
+		stdout, stderr, code := runCommand(t, "", args...)
+		if code != exitUsage {
+			t.Errorf("%q: exit code %d, want %d", args, code, exitUsage)
+		}
+		if stdout != "" || !strings.Contains(stderr, "Usage:") {
+			t.Errorf("%q: stdout %q, stderr %q, want usage on stderr", args, stdout, stderr)
+		}
+	}
+}
+
+func TestRunConnectionError(t *testing.T) {
+	address := "unix:" + filepath.Join(t.TempDir(), "missing.sock")
+
+	_, stderr, code := runCommand(t, "", "info", address)
+	if code != exitConnection {
+		t.Errorf("exit code %d, want %d", code, exitConnection)
+	}
+	if !strings.Contains(stderr, "Cannot connect to") {
+		t.Errorf("stderr %q", stderr)
+	}
+}
+
+func TestRunFormat(t *testing.T) {
+	stdout, stderr, code := runCommand(t, "{\"b\":1,\"a\":[true]}\n{}\n", "format", "-preserve-order")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	want := "{\n  \"b\": 1,\n  \"a\": [\n    true\n  ]\n}\n{}\n"
+	if stdout != want {
+		t.Errorf("stdout %q, want %q", stdout, want)
+	}
+}
+
+func TestRunInfo(t *testing.T) {
+	address := startTestService(t)
+	defer func(v bool) { color.NoColor = v }(color.NoColor)
+	color.NoColor = true
+
+	for _, tt := range []struct {
+		flag string
+		want string
+	}{
+		{
+			"",
+			"Vendor: Varlink\nProduct: Test\nVersion: 1\nURL: https://varlink.org\n" +
+				"Interfaces:\n  org.varlink.service\n  org.example.test\n",
+		},
+		{
+			"-tree",
+			"Vendor: Varlink\nProduct: Test\nVersion: 1\nURL: https://varlink.org\n" +
+				"Interfaces:\n  org\n    example.test\n    varlink.service\n",
+		},
+		{
+			"-compact",
+			"Varlink\nTest\n1\nhttps://varlink.org\norg.varlink.service\norg.example.test\n",
+		},
+	} {
+		args := []string{"info"}
+		if tt.flag != "" {
+			args = append(args, tt.flag)
+		}
+		stdout, stderr, code := runCommand(t, "", append(args, address)...)
+		if code != 0 {
+			t.Fatalf("%v: exit code %d, stderr %q", args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: stdout %q, want %q", args, stdout, tt.want)
+		}
+	}
+}
+
+// -color on colorizes even when stdout is no terminal and TERM is unset,
+// as when piping into less -R.
+func TestColorOn(t *testing.T) {
+	defer func(v, e bool, s string) { color.NoColor, stderrColor, errorBoldRed = v, e, s }(color.NoColor, stderrColor, errorBoldRed)
+	t.Setenv("TERM", "")
+
+	setupColor(&streams{}, "on", false)
+	stdout, _, code := runCommand(t, `{"a":"b"}`, "format")
+	if code != 0 || !strings.Contains(stdout, "\x1b[") {
+		t.Errorf("-color on: exit code %d, no color codes in %q", code, stdout)
+	}
+	_, stderr, _ := runCommand(t, "", "call", "unix:"+filepath.Join(t.TempDir(), "none")+"/org.example.test.Echo")
+	if !strings.Contains(stderr, "\x1b[") {
+		t.Errorf("-color on: no color codes in stderr %q", stderr)
+	}
+
+	setupColor(&streams{}, "off", false)
+	stdout, _, _ = runCommand(t, `{"a":"b"}`, "format")
+	if strings.Contains(stdout, "\x1b[") {
+		t.Errorf("-color off: color codes in %q", stdout)
+	}
+}
+
+// By default, stderr is only colorized if it is a terminal, TERM is set
+// and NO_COLOR is not.
+func TestStderrColorAuto(t *testing.T) {
+	defer func(v, e bool, s string) { color.NoColor, stderrColor, errorBoldRed = v, e, s }(color.NoColor, stderrColor, errorBoldRed)
+	t.Setenv("TERM", "xterm")
+	t.Setenv("NO_COLOR", "")
+
+	// Redirected to a file.
+	f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	std := &streams{in: strings.NewReader(""), out: io.Discard, err: f}
+	setupColor(std, "auto", false)
+	_ = run(context.Background(), std, []string{"call", "unix:" + filepath.Join(t.TempDir(), "none") + "/org.example.test.Echo"})
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "Cannot connect") || strings.Contains(string(b), "\x1b[") {
+		t.Errorf("stderr redirected to a file: %q", b)
+	}
+
+	// A terminal, unless told otherwise.
+	defer func(f func(*os.File) bool) { isTerminal = f }(isTerminal)
+	isTerminal = func(*os.File) bool { return true }
+	for _, tt := range []struct {
+		term, noColor string
+		noStderrColor bool
+		want          bool
+	}{
+		{"xterm", "", false, true},
+		{"xterm", "1", false, false},
+		{"dumb", "", false, false},
+		{"", "", false, false},
+		{"xterm", "", true, false},
+	} {
+		t.Setenv("TERM", tt.term)
+		t.Setenv("NO_COLOR", tt.noColor)
+		setupColor(std, "auto", tt.noStderrColor)
+		if stderrColor != tt.want {
+			t.Errorf("TERM=%q NO_COLOR=%q -no-stderr-color=%v: colors %v, want %v", tt.term, tt.noColor, tt.noStderrColor, stderrColor, tt.want)
+		}
+	}
+
+	// Not a file at all.
+	setupColor(&streams{err: io.Discard}, "auto", false)
+	if stderrColor {
+		t.Error("colors for stderr that is not a file")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+// mockReply is the canned reply to a method, written like a reply on
+// the wire. A responses file maps method names to replies:
+//
+//	{
+//	  "org.example.foo.Lookup": {"parameters": {"name": "foo"}},
+//	  "org.example.foo.Delete": {"error": "org.example.foo.NotFound", "parameters": {"id": 1}}
+//	}
+type mockReply struct {
+	Parameters json.RawMessage `json:"parameters"`
+	Error      string          `json:"error"`
+}
+
+// mockInterface answers the methods of one interface with canned
+// replies.
+type mockInterface struct {
+	std     *streams
+	name    string
+	replies map[string]*mockReply
+}
+
+func (m *mockInterface) VarlinkGetName() string {
+	return m.name
+}
+
+// VarlinkGetDescription returns an interface description declaring the
+// mocked methods. The mock knows nothing about their types.
+func (m *mockInterface) VarlinkGetDescription() string {
+	methods := make([]string, 0, len(m.replies))
+	for method := range m.replies {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Mock of %s served by varlink serve-mock.\ninterface %s\n", m.name, m.name)
+	for _, method := range methods {
+		fmt.Fprintf(&b, "\nmethod %s() -> ()\n", method)
+	}
+	return b.String()
+}
+
+func (m *mockInterface) VarlinkDispatch(ctx context.Context, c varlink.Call, methodname string) error {
+	r, ok := m.replies[methodname]
+	if !ok {
+		return c.ReplyMethodNotFound(ctx, m.name+"."+methodname)
+	}
+
+	if debug {
+		fmt.Fprintf(m.std.err, "Replying to '%s.%s'\n", m.name, methodname)
+	}
+
+	var params interface{}
+	if len(r.Parameters) != 0 {
+		params = r.Parameters
+	}
+	if r.Error != "" {
+		return c.ReplyError(ctx, r.Error, params)
+	}
+	return c.Reply(ctx, params)
+}
+
+// readMockResponses reads a responses file and groups the replies by
+// interface.
+func readMockResponses(path string) (map[string]*mockInterface, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses map[string]*mockReply
+	if err := json.Unmarshal(b, &responses); err != nil {
+		return nil, err
+	}
+
+	interfaces := make(map[string]*mockInterface)
+	for method, reply := range responses {
+		li := strings.LastIndex(method, ".")
+		if li <= 0 {
+			return nil, fmt.Errorf("invalid method name '%s'", method)
+		}
+		if reply == nil {
+			return nil, fmt.Errorf("no reply for '%s'", method)
+		}
+
+		name := method[:li]
+		iface, ok := interfaces[name]
+		if !ok {
+			iface = &mockInterface{name: name, replies: make(map[string]*mockReply)}
+			interfaces[name] = iface
+		}
+		iface.replies[method[li+1:]] = reply
+	}
+	return interfaces, nil
+}
+
+// serveMockOptions are the options of serve-mock.
+type serveMockOptions struct {
+	help bool
+}
+
+func (o *serveMockOptions) flagSet() *flag.FlagSet {
+	mockFlags := flag.NewFlagSet("serve-mock", flag.ContinueOnError)
+	mockFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return mockFlags
+}
+
+func varlinkServeMock(ctx context.Context, std *streams, args []string) error {
+	var o serveMockOptions
+	mockFlags := o.flagSet()
+	usage := func() error { return std.usage(mockFlags, "<RESPONSES.json> <ADDRESS>") }
+	mockFlags.SetOutput(std.err)
+	mockFlags.Usage = func() {}
+
+	if err := mockFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || mockFlags.NArg() != 2 {
+		return usage()
+	}
+
+	interfaces, err := readMockResponses(mockFlags.Arg(0))
+	if err != nil {
+		return std.fail(exitFailure, "Cannot read responses '%s': %v\n", mockFlags.Arg(0), err)
+	}
+
+	service, err := varlink.NewService("varlink", "serve-mock", "1", "https://varlink.org")
+	if err != nil {
+		return std.fail(exitFailure, "Cannot create service: %v\n", err)
+	}
+
+	names := make([]string, 0, len(interfaces))
+	for name := range interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		interfaces[name].std = std
+		if err := service.RegisterInterface(interfaces[name]); err != nil {
+			return std.fail(exitFailure, "Cannot register interface '%s': %v\n", name, err)
+		}
+	}
+
+	address := mockFlags.Arg(1)
+	if err := service.Listen(ctx, address, 0); err != nil {
+		return std.fail(exitConnection, "Cannot serve on '%s': %v\n", address, err)
+	}
+	return nil
+}
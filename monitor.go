@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/varlink/go/varlink"
+)
+
+// checkService reports whether the service at address answers GetInfo
+// within timeout.
+func checkService(ctx context.Context, address string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	con, err := varlink.NewConnection(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	return con.GetInfo(ctx, nil, nil, nil, nil, nil)
+}
+
+// monitorOptions are the options of monitor.
+type monitorOptions struct {
+	interval time.Duration
+	help     bool
+}
+
+func (o *monitorOptions) flagSet() *flag.FlagSet {
+	monitorFlags := flag.NewFlagSet("monitor", flag.ContinueOnError)
+	monitorFlags.DurationVar(&o.interval, "interval", time.Second, "Time between checks")
+	monitorFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return monitorFlags
+}
+
+func varlinkMonitor(ctx context.Context, std *streams, args []string) error {
+	var o monitorOptions
+	monitorFlags := o.flagSet()
+	usage := func() error { return std.usage(monitorFlags, "<ADDRESS>") }
+	monitorFlags.SetOutput(std.err)
+	monitorFlags.Usage = func() {}
+
+	if err := monitorFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || monitorFlags.NArg() != 1 || o.interval <= 0 {
+		return usage()
+	}
+	address := monitorFlags.Arg(0)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	up := color.New(color.FgGreen).Sprint("up")
+	down := color.New(color.FgRed).Sprint("down")
+
+	start := time.Now()
+	checks, upChecks := 0, 0
+	var last *bool
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		err := checkService(ctx, address, o.interval)
+		if ctx.Err() != nil {
+			break
+		}
+
+		checks++
+		isUp := err == nil
+		if isUp {
+			upChecks++
+		}
+
+		if last == nil || *last != isUp {
+			now := time.Now().Format(time.RFC3339)
+			if isUp {
+				fmt.Fprintf(std.out, "%s %s %s\n", now, address, up)
+			} else {
+				fmt.Fprintf(std.out, "%s %s %s: %v\n", now, address, down, err)
+			}
+			last = &isUp
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			continue
+		}
+		break
+	}
+
+	if checks == 0 {
+		return nil
+	}
+	fmt.Fprintf(std.out, "%s %.1f%% of %d checks in %v\n",
+		bold.Sprint("Up:"),
+		float64(upChecks)*100/float64(checks),
+		checks,
+		time.Since(start).Round(time.Second))
+	return nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+func newFormatter() *formatter {
+	return &formatter{
+		Indent:      2,
+		KeyColor:    color.New(color.FgCyan),
+		StringColor: color.New(color.FgMagenta),
+		NumberColor: color.New(color.FgGreen),
+		BoolColor:   color.New(color.FgMagenta),
+		NullColor:   color.New(color.FgMagenta),
+	}
+}
+
+// newStderrFormatter returns a formatter for output to stderr, which is
+// colored independently of stdout.
+func newStderrFormatter() *formatter {
+	return &formatter{
+		Indent:      2,
+		KeyColor:    errColor(color.FgCyan),
+		StringColor: errColor(color.FgMagenta),
+		NumberColor: errColor(color.FgGreen),
+		BoolColor:   errColor(color.FgMagenta),
+		NullColor:   errColor(color.FgMagenta),
+	}
+}
+
+// printFormatted prints v rendered by f to w. If f cannot render v, it
+// is printed as plain JSON instead.
+func printFormatted(std *streams, w io.Writer, f *formatter, v interface{}) error {
+	c, err := f.Marshal(v)
+	if err != nil {
+		if debug {
+			fmt.Fprintf(std.err, "Cannot format value, printing plain JSON: %v\n", err)
+		}
+		if c, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(w, string(c))
+	return err
+}
+
+// writeOutputFile writes v as indented JSON without colors to path,
+// or as compact JSON on a single line with compact. With appendMode it
+// is instead appended to path as a single line, so that the file
+// collects one JSON document per line.
+func writeOutputFile(path string, v interface{}, appendMode bool, compact bool) error {
+	if !appendMode && !compact {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, append(b, '\n'), 0o644)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !appendMode {
+		return os.WriteFile(path, append(b, '\n'), 0o644)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func parseFieldList(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+	fields := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields[f] = true
+		}
+	}
+	return fields
+}
+
+// redact returns a copy of v with the values of all object members
+// named in fields replaced by "***", at any depth.
+func redact(v interface{}, fields map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			if fields[k] {
+				m[k] = "***"
+			} else {
+				m[k] = redact(e, fields)
+			}
+		}
+		return m
+	case *orderedObject:
+		o := &orderedObject{keys: v.keys, values: make(map[string]interface{}, len(v.values))}
+		for k, e := range v.values {
+			if fields[k] {
+				o.values[k] = "***"
+			} else {
+				o.values[k] = redact(e, fields)
+			}
+		}
+		return o
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = redact(e, fields)
+		}
+		return a
+	}
+	return v
+}
+
+// expandJSONStrings returns a copy of v with string values holding a
+// JSON object or array replaced by the decoded value.
+func expandJSONStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = expandJSONStrings(e)
+		}
+		return m
+	case *orderedObject:
+		o := &orderedObject{keys: v.keys, values: make(map[string]interface{}, len(v.values))}
+		for k, e := range v.values {
+			o.values[k] = expandJSONStrings(e)
+		}
+		return o
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = expandJSONStrings(e)
+		}
+		return a
+	case string:
+		// Only objects and arrays, strings like "1" or "true" stay as
+		// they are.
+		s := strings.TrimSpace(v)
+		if !strings.HasPrefix(s, "{") && !strings.HasPrefix(s, "[") {
+			return v
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+			return v
+		}
+		return expandJSONStrings(decoded)
+	}
+	return v
+}
+
+// truncateStrings returns a copy of v with strings longer than max
+// characters cut to max, noting their original length.
+func truncateStrings(v interface{}, max int) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = truncateStrings(e, max)
+		}
+		return m
+	case *orderedObject:
+		o := &orderedObject{keys: v.keys, values: make(map[string]interface{}, len(v.values))}
+		for k, e := range v.values {
+			o.values[k] = truncateStrings(e, max)
+		}
+		return o
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = truncateStrings(e, max)
+		}
+		return a
+	case string:
+		runes := []rune(v)
+		if len(runes) <= max {
+			return v
+		}
+		return fmt.Sprintf("%s… (%d characters)", string(runes[:max]), len(runes))
+	}
+	return v
+}
+
+// writeCSV writes a reply holding a single array of objects as CSV,
+// with a header of all their member names. Nested values are written
+// as JSON, missing members as empty cells.
+func writeCSV(w io.Writer, reply map[string]interface{}) error {
+	var rows []interface{}
+	if len(reply) == 1 {
+		for _, v := range reply {
+			rows, _ = v.([]interface{})
+		}
+	}
+	if rows == nil {
+		return errors.New("the reply does not consist of a single array of objects")
+	}
+
+	seen := make(map[string]bool)
+	var header []string
+	for _, row := range rows {
+		m, ok := row.(map[string]interface{})
+		if !ok {
+			return errors.New("the reply array does not consist of objects")
+		}
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				header = append(header, k)
+			}
+		}
+	}
+	sort.Strings(header)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		m := row.(map[string]interface{})
+		record := make([]string, len(header))
+		for i, k := range header {
+			switch v := m[k].(type) {
+			case nil:
+			case string:
+				record[i] = v
+			default:
+				b, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				record[i] = string(b)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// flatKey escapes the dots, equal signs and backslashes of an object
+// member name for writeFlat.
+var flatKey = strings.NewReplacer(`\`, `\\`, `.`, `\.`, `=`, `\=`)
+
+// writeFlat writes v as one "path=value" line per value, e.g.
+// "items.0.name=x", with object members sorted by name. Strings are
+// written as they are unless they hold line breaks or other control
+// characters or start with a quote; those and all other values are
+// written as JSON.
+func writeFlat(w io.Writer, path string, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && path != "" {
+			_, err := fmt.Fprintf(w, "%s={}\n", path)
+			return err
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := writeFlat(w, joinFlat(path, flatKey.Replace(k)), v[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if len(v) == 0 {
+			_, err := fmt.Fprintf(w, "%s=[]\n", path)
+			return err
+		}
+		for i, e := range v {
+			if err := writeFlat(w, joinFlat(path, fmt.Sprint(i)), e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case string:
+		if !strings.HasPrefix(v, `"`) && strings.IndexFunc(v, unicode.IsControl) == -1 {
+			_, err := fmt.Fprintf(w, "%s=%s\n", path, v)
+			return err
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s=%s\n", path, b)
+	return err
+}
+
+func joinFlat(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPrintFormatted(t *testing.T) {
+	defer func(v bool) { debug = v }(debug)
+	debug = true
+
+	var out, stderr bytes.Buffer
+	std := &streams{in: strings.NewReader(""), out: &out, err: &stderr}
+	f := newFormatter()
+
+	// Values not decoded from JSON are printed as JSON.
+	if err := printFormatted(std, &out, f, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[\"a\"]\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	// A value that cannot be printed at all is an error, not empty
+	// output.
+	out.Reset()
+	err := printFormatted(std, &out, f, map[string]interface{}{"a": math.NaN()})
+	if err == nil || !strings.Contains(err.Error(), "NaN") {
+		t.Errorf("got error %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("got output %q", out.String())
+	}
+	if !strings.Contains(stderr.String(), "Cannot format value, printing plain JSON") {
+		t.Errorf("no diagnostic in %q", stderr.String())
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// page prints text to stdout. Like git, text that does not fit on the
+// terminal is shown with $PAGER, or less -R to keep the colors. With
+// force the pager is used whenever stdout is a terminal.
+func page(std *streams, text string, force bool) {
+	f, ok := std.out.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(std.out, text)
+		return
+	}
+
+	if !force {
+		_, height, err := term.GetSize(int(f.Fd()))
+		if err != nil || strings.Count(text, "\n") < height {
+			fmt.Fprint(std.out, text)
+			return
+		}
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = std.out
+	cmd.Stderr = std.err
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	err := cmd.Run()
+
+	// The shell exits with 127 if the pager is not installed.
+	var exitErr *exec.ExitError
+	if err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() == 127) {
+		if debug {
+			fmt.Fprintf(std.err, "Cannot run pager '%s': %v\n", pager, err)
+		}
+		fmt.Fprint(std.out, text)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// peerCredAvailable reports whether SO_PEERCRED is available.
+const peerCredAvailable = true
+
+// ucred returns the SO_PEERCRED credentials of a unix socket connection.
+func ucred(c net.Conn) (*syscall.Ucred, bool) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return nil, false
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, false
+	}
+
+	var cred *syscall.Ucred
+	err = raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return nil, false
+	}
+	return cred, true
+}
+
+// peerCred describes the process at the other end of a unix socket
+// connection, as reported by SO_PEERCRED.
+func peerCred(c net.Conn) (string, bool) {
+	cred, ok := ucred(c)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("pid %d, uid %d, gid %d", cred.Pid, cred.Uid, cred.Gid), true
+}
+
+// peerUID returns the user at the other end of a unix socket connection.
+func peerUID(c net.Conn) (int, bool) {
+	cred, ok := ucred(c)
+	if !ok {
+		return 0, false
+	}
+	return int(cred.Uid), true
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDebugPeer(t *testing.T) {
+	address := startTestService(t)
+	defer func(v bool) { debug = v }(debug)
+	debug = true
+
+	// Count the connections to the service on their way.
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var accepted atomic.Int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			s, err := net.Dial("unix", strings.TrimPrefix(address, "unix:"))
+			if err != nil {
+				c.Close()
+				continue
+			}
+			go relay(c, s)
+		}
+	}()
+
+	_, stderr, code := runCommand(t, "", "call", "unix:"+path+"/org.example.test.Echo", "{}")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr)
+	}
+	want := fmt.Sprintf("peer pid %d, uid %d, gid %d", os.Getpid(), os.Getuid(), os.Getgid())
+	if !strings.Contains(stderr, want) {
+		t.Errorf("stderr %q does not contain %q", stderr, want)
+	}
+	// The peer is read from the connection of the call.
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+}
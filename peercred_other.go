@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// peerCredAvailable reports whether SO_PEERCRED is available.
+const peerCredAvailable = false
+
+// peerCred is not available without SO_PEERCRED.
+func peerCred(c net.Conn) (string, bool) {
+	return "", false
+}
+
+// peerUID is not available without SO_PEERCRED.
+func peerUID(c net.Conn) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+)
+
+// formatOptions are the options of format.
+type formatOptions struct {
+	indent        int
+	prettyDepth   int
+	preserveOrder bool
+	help          bool
+}
+
+func (o *formatOptions) flagSet() *flag.FlagSet {
+	formatFlags := flag.NewFlagSet("format", flag.ContinueOnError)
+	formatFlags.IntVar(&o.indent, "indent", 2, "Number of spaces to indent nested values by")
+	formatFlags.IntVar(&o.prettyDepth, "pretty-depth", 0, "Print objects and arrays nested deeper than N on a single line")
+	formatFlags.BoolVar(&o.preserveOrder, "preserve-order", false, "Print object members in the order of the file")
+	formatFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return formatFlags
+}
+
+func varlinkFormat(_ context.Context, std *streams, args []string) error {
+	var o formatOptions
+	formatFlags := o.flagSet()
+	usage := func() error { return std.usage(formatFlags, "[FILE]") }
+	formatFlags.SetOutput(std.err)
+	formatFlags.Usage = func() {}
+
+	if err := formatFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || formatFlags.NArg() > 1 || o.indent < 0 {
+		return usage()
+	}
+
+	r := newStdinReader(std)
+	name := "stdin"
+	if path := formatFlags.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot read '%s': %v\n", path, err)
+		}
+		defer file.Close()
+		r, name = file, path
+	}
+
+	f := newFormatter()
+	f.Indent = o.indent
+	f.MaxDepth = o.prettyDepth
+
+	// Files written with -output-append hold one reply per line.
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return std.fail(exitFailure, "Cannot parse '%s': %v\n", name, err)
+		}
+
+		var v interface{}
+		var err error
+		if o.preserveOrder {
+			v, err = decodeOrdered(raw)
+		} else {
+			err = json.Unmarshal(raw, &v)
+		}
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse '%s': %v\n", name, err)
+		}
+
+		if err := printFormatted(std, std.out, f, v); err != nil {
+			return std.fail(exitFailure, "Cannot print '%s': %v\n", name, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveRaw accepts connections on a unix socket until the test ends,
+// reads one call on each and answers with reply(n) for the nth call,
+// then hangs up. Asking for the service info is not counted and gets no
+// answer. It returns the address and the number of calls so far.
+func serveRaw(t *testing.T, reply func(n int32) string) (string, *atomic.Int32) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "raw.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var calls atomic.Int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				request, err := bufio.NewReader(c).ReadString(0)
+				if err != nil || strings.Contains(request, "org.varlink.service.GetInfo") {
+					return
+				}
+				_, _ = c.Write([]byte(reply(calls.Add(1))))
+			}()
+		}
+	}()
+	return "unix:" + path, &calls
+}
+
+func TestCallReconnect(t *testing.T) {
+	// One reply of a stream, then the connection drops, and then it
+	// drops without a reply.
+	address, accepted := serveRaw(t, func(n int32) string {
+		if n == 1 {
+			return "{\"parameters\":{\"n\":1},\"continues\":true}\x00"
+		}
+		return ""
+	})
+
+	stdout, stderr, code := runCommand(t, "", "call", "-more", "-reconnect", "-max-reconnects", "2", address+"/org.example.test.Count", `{"count":3}`)
+	if code != exitConnection {
+		t.Errorf("exit code %d, want %d, stderr %q", code, exitConnection, stderr)
+	}
+	if !strings.Contains(stderr, "giving up after 2 reconnects") {
+		t.Errorf("stderr %q", stderr)
+	}
+	if n := strings.Count(stdout, `"n": 1`); n != 1 {
+		t.Errorf("%d replies, want 1, stdout %q", n, stdout)
+	}
+	if n := accepted.Load(); n != 3 {
+		t.Errorf("%d connections, want 3", n)
+	}
+}
+
+// Errors other than a dropped connection are not retried.
+func TestCallReconnectOnlyDropped(t *testing.T) {
+	address, accepted := serveRaw(t, func(n int32) string { return "{\"parameters\":\x00" })
+
+	_, stderr, code := runCommand(t, "", "call", "-more", "-reconnect", address+"/org.example.test.Count", `{"count":3}`)
+	if code == 0 {
+		t.Errorf("exit code 0, stderr %q", stderr)
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("%d connections, want 1, stderr %q", n, stderr)
+	}
+}
+
+// serveConns accepts connections on a unix socket until the test ends and
+// hands each to serve with its number, counting from 1.
+func serveConns(t *testing.T, serve func(n int32, c net.Conn)) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "conns.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var n atomic.Int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(n int32) {
+				defer c.Close()
+				serve(n, c)
+			}(n.Add(1))
+		}
+	}()
+	return "unix:" + path
+}
+
+// A service that replied before is not probed when the connection drops.
+func TestCallReconnectNoProbe(t *testing.T) {
+	var conns atomic.Int32
+	address := serveConns(t, func(n int32, c net.Conn) {
+		conns.Add(1)
+		if _, err := bufio.NewReader(c).ReadString(0); err != nil {
+			return
+		}
+		if n == 1 {
+			_, _ = c.Write([]byte("{\"parameters\":{\"n\":1},\"continues\":true}\x00"))
+		}
+	})
+
+	_, stderr, code := runCommand(t, "", "call", "-more", "-reconnect", "-max-reconnects", "2", address+"/org.example.test.Count", `{"count":3}`)
+	if code != exitConnection || !strings.Contains(stderr, "giving up after 2 reconnects") {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+	// The call and two reconnects, no probes.
+	if n := conns.Load(); n != 3 {
+		t.Errorf("%d connections, want 3", n)
+	}
+}
+
+// A service hanging up before any reply is asked once more with a plain
+// GetInfo call.
+func TestNotVarlinkProbe(t *testing.T) {
+	probe := make(chan string, 1)
+	address := serveConns(t, func(n int32, c net.Conn) {
+		if n == 1 {
+			_, _ = bufio.NewReader(c).ReadString(0)
+			return
+		}
+		_ = c.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		b, _ := io.ReadAll(c)
+		probe <- string(b)
+	})
+
+	_, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Echo", "{}")
+	if code != exitConnection || !strings.Contains(stderr, "Server closed connection") {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+	select {
+	case got := <-probe:
+		if want := "{\"method\":\"org.varlink.service.GetInfo\"}\x00"; got != want {
+			t.Errorf("probe %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no probe")
+	}
+}
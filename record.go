@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// recording is a method call and its outcome as saved by record:
+//
+//	{
+//	  "address": "unix:/run/org.example.foo",
+//	  "method": "org.example.foo.Lookup",
+//	  "parameters": {"id": 1},
+//	  "reply": {"name": "foo"}
+//	}
+//
+// If the call failed, "error" holds the name of the varlink error and
+// "reply" its parameters.
+type recording struct {
+	Address    string          `json:"address,omitempty"`
+	Method     string          `json:"method"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Reply      json.RawMessage `json:"reply,omitempty"`
+}
+
+// outcome returns the error and reply of r as one decoded value, so
+// that two recordings can be compared with diffJSON.
+func (r *recording) outcome() interface{} {
+	o := make(map[string]interface{})
+	if r.Error != "" {
+		o["error"] = r.Error
+	}
+	if len(r.Reply) != 0 {
+		var reply interface{}
+		_ = json.Unmarshal(r.Reply, &reply)
+		o["reply"] = reply
+	}
+	return o
+}
+
+// recordCall calls the method of r and stores the outcome in r.
+func recordCall(ctx context.Context, std *streams, r *recording) error {
+	con, err := openConnection(ctx, std, r.Address)
+	if err != nil {
+		return err
+	}
+	defer closeConnection(con)
+
+	var params interface{}
+	if len(r.Parameters) != 0 {
+		params = r.Parameters
+	}
+
+	var reply json.RawMessage
+	err = con.Call(ctx, r.Method, params, &reply)
+	if err != nil {
+		e, ok := varlinkError(err)
+		if !ok {
+			if err := notVarlink(std, err, r.Address); err != nil {
+				return err
+			}
+			return std.fail(exitFailure, "Error calling '%s': %v\n", r.Method, err)
+		}
+		r.Error = e.Name
+		if p, ok := e.Parameters.(*json.RawMessage); ok && p != nil {
+			reply = *p
+		}
+	}
+	r.Reply = reply
+	return nil
+}
+
+// recordOptions are the options of record.
+type recordOptions struct {
+	inputFormat string
+	help        bool
+}
+
+func (o *recordOptions) flagSet() *flag.FlagSet {
+	recordFlags := flag.NewFlagSet("record", flag.ContinueOnError)
+	recordFlags.StringVar(&o.inputFormat, "input-format", "json", "Format of ARGUMENTS [possible values: json, yaml, toml]")
+	recordFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return recordFlags
+}
+
+func varlinkRecord(ctx context.Context, std *streams, args []string) error {
+	var err error
+
+	var o recordOptions
+	recordFlags := o.flagSet()
+	usage := func() error { return std.usage(recordFlags, "<FILE> <[ADDRESS/]INTERFACE.METHOD> [ARGUMENTS]") }
+	recordFlags.SetOutput(std.err)
+	recordFlags.Usage = func() {}
+
+	if err := recordFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || recordFlags.NArg() < 2 {
+		return usage()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var r recording
+	if len(bridge) != 0 || useActivation(recordFlags.Arg(1)) {
+		r.Method = recordFlags.Arg(1)
+	} else {
+		uri := recordFlags.Arg(1)
+		li := strings.LastIndex(uri, "/")
+		if li == -1 {
+			return std.fail(exitFailure, "Invalid address '%s'\n", uri)
+		}
+		r.Address = uri[:li]
+		r.Method = uri[li+1:]
+	}
+	if err := allowMethod(std, r.Method); err != nil {
+		return err
+	}
+
+	if parameters := recordFlags.Arg(2); parameters != "" {
+		r.Parameters, err = parseParameters(parameters, o.inputFormat)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot parse parameters: %v\n", err)
+		}
+	}
+
+	if err := recordCall(ctx, std, &r); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(&r, "", "  ")
+	if err != nil {
+		return std.fail(exitFailure, "Cannot encode recording: %v\n", err)
+	}
+	if err := os.WriteFile(recordFlags.Arg(0), append(b, '\n'), 0644); err != nil {
+		return std.fail(exitFailure, "Cannot write recording to '%s': %v\n", recordFlags.Arg(0), err)
+	}
+	return nil
+}
+
+// replayOptions are the options of replay.
+type replayOptions struct {
+	help bool
+}
+
+func (o *replayOptions) flagSet() *flag.FlagSet {
+	replayFlags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	replayFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return replayFlags
+}
+
+func varlinkReplay(ctx context.Context, std *streams, args []string) error {
+	var o replayOptions
+	replayFlags := o.flagSet()
+	usage := func() error { return std.usage(replayFlags, "<FILE> [ADDRESS]") }
+	replayFlags.SetOutput(std.err)
+	replayFlags.Usage = func() {}
+
+	if err := replayFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || replayFlags.NArg() < 1 {
+		return usage()
+	}
+
+	file := replayFlags.Arg(0)
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return std.fail(exitFailure, "Cannot read recording: %v\n", err)
+	}
+
+	var recorded recording
+	if err := json.Unmarshal(b, &recorded); err != nil {
+		return std.fail(exitFailure, "Cannot parse recording '%s': %v\n", file, err)
+	}
+	if recorded.Method == "" {
+		return std.fail(exitFailure, "Recording '%s' names no method\n", file)
+	}
+	if err := allowMethod(std, recorded.Method); err != nil {
+		return err
+	}
+
+	replayed := recording{
+		Address:    recorded.Address,
+		Method:     recorded.Method,
+		Parameters: recorded.Parameters,
+	}
+	if address := replayFlags.Arg(1); address != "" {
+		replayed.Address = address
+	}
+	if replayed.Address == "" && len(bridge) == 0 && !activated() {
+		std.errorf("No ADDRESS or activation or bridge\n\n")
+		return usage()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := recordCall(ctx, std, &replayed); err != nil {
+		return err
+	}
+
+	diffs := diffJSON("", recorded.outcome(), replayed.outcome())
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(std.out, bold.Sprintf("--- %s", file))
+	fmt.Fprintln(std.out, bold.Sprintf("+++ %s", replayed.Method))
+	printDiff(std.out, diffs)
+	return exitError(exitDiffers)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	address := startTestService(t)
+	dir := t.TempDir()
+
+	for _, tt := range []struct {
+		method string
+		params string
+		want   recording
+	}{
+		{
+			"org.example.test.Echo", `{"value":{"a":1}}`,
+			recording{Reply: json.RawMessage(`{"value":{"a":1}}`)},
+		},
+		{
+			"org.example.test.Fail", "",
+			recording{Error: "org.example.test.NotHere", Reply: json.RawMessage(`{"code":3}`)},
+		},
+		{
+			"org.example.test.Nope", "",
+			recording{Error: "org.varlink.service.MethodNotFound", Reply: json.RawMessage(`{"method":"Nope"}`)},
+		},
+	} {
+		file := filepath.Join(dir, tt.method+".json")
+		args := []string{"record", file, address + "/" + tt.method}
+		if tt.params != "" {
+			args = append(args, tt.params)
+		}
+		if _, stderr, code := runCommand(t, "", args...); code != 0 {
+			t.Fatalf("record %s: exit code %d, stderr %q", tt.method, code, stderr)
+		}
+
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r recording
+		if err := json.Unmarshal(b, &r); err != nil {
+			t.Fatal(err)
+		}
+		var reply bytes.Buffer
+		if err := json.Compact(&reply, r.Reply); err != nil {
+			t.Fatal(err)
+		}
+		if r.Error != tt.want.Error || reply.String() != string(tt.want.Reply) {
+			t.Errorf("record %s: error %q, reply %s, want %q, %s", tt.method, r.Error, reply.String(), tt.want.Error, tt.want.Reply)
+		}
+
+		if stdout, stderr, code := runCommand(t, "", "replay", file); code != 0 {
+			t.Errorf("replay %s: exit code %d, stdout %q, stderr %q", tt.method, code, stdout, stderr)
+		}
+	}
+}
+
+func TestReplayDiffers(t *testing.T) {
+	address := startTestService(t)
+	file := filepath.Join(t.TempDir(), "recording.json")
+	r := `{"address":"` + address + `","method":"org.example.test.Echo","parameters":{"value":{"a":1}},"reply":{"value":{"a":2}}}`
+	if err := os.WriteFile(file, []byte(r), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runCommand(t, "", "replay", file)
+	if code != exitDiffers {
+		t.Errorf("exit code %d, want %d, stderr %q", code, exitDiffers, stderr)
+	}
+	if !strings.Contains(stdout, "value.a") {
+		t.Errorf("stdout %q does not show the difference", stdout)
+	}
+}
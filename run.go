@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// An invocation file describes a canned call, one "key: value" per line:
+//
+//	#!/usr/bin/env -S varlink run
+//	# Lines starting with '#' are comments.
+//	address: unix:/run/org.example.foo
+//	method: org.example.foo.Lookup
+//	parameters: {"verbose": true}
+//
+// Instead of address, "bridge" names a bridge command; the global
+// -bridge and -connect-via cannot be combined with either. "more" and
+// "oneway" take a boolean as understood by strconv.ParseBool, like true
+// or false, and set the call flags of the same name.
+type invocation struct {
+	address    string
+	bridge     string
+	method     string
+	parameters string
+	more       bool
+	oneway     bool
+}
+
+func readInvocation(path string) (*invocation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var inv invocation
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", n)
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+
+		switch key {
+		case "address":
+			inv.address = value
+		case "bridge":
+			inv.bridge = value
+		case "method":
+			inv.method = value
+		case "parameters":
+			inv.parameters = value
+		case "more", "oneway":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: '%s' is not true or false", n, value)
+			}
+			if key == "more" {
+				inv.more = b
+			} else {
+				inv.oneway = b
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown key '%s'", n, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if inv.method == "" {
+		return nil, fmt.Errorf("no method given")
+	}
+	if inv.address == "" && inv.bridge == "" {
+		return nil, fmt.Errorf("no address or bridge given")
+	}
+	return &inv, nil
+}
+
+// runOptions are the options of run.
+type runOptions struct {
+	help bool
+}
+
+func (o *runOptions) flagSet() *flag.FlagSet {
+	runFlags := flag.NewFlagSet("run", flag.ContinueOnError)
+	runFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return runFlags
+}
+
+func varlinkRun(ctx context.Context, std *streams, args []string) error {
+	var o runOptions
+	runFlags := o.flagSet()
+	usage := func() error { return std.usage(runFlags, "<FILE> [NAME=VALUE]...") }
+	runFlags.SetOutput(std.err)
+	runFlags.Usage = func() {}
+
+	if err := runFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || runFlags.NArg() == 0 {
+		return usage()
+	}
+
+	inv, err := readInvocation(runFlags.Arg(0))
+	if err != nil {
+		return std.fail(exitFailure, "Cannot read invocation file '%s': %v\n", runFlags.Arg(0), err)
+	}
+	if inv.address != "" && inv.bridge != "" {
+		std.errorf("Invocation file '%s' cannot give both an address and a bridge\n\n", runFlags.Arg(0))
+		return usage()
+	}
+	if bridge != "" {
+		// The invocation file says where to connect to.
+		std.errorf("-bridge and -connect-via cannot be combined with run\n\n")
+		return usage()
+	}
+
+	var callArgs []string
+	if inv.more {
+		callArgs = append(callArgs, "-more")
+	}
+	if inv.oneway {
+		callArgs = append(callArgs, "-oneway")
+	}
+	for _, p := range runFlags.Args()[1:] {
+		callArgs = append(callArgs, "-param", p)
+	}
+
+	if inv.bridge != "" {
+		callArgs = append(callArgs, inv.method)
+	} else {
+		callArgs = append(callArgs, inv.address+"/"+inv.method)
+	}
+	if inv.parameters != "" {
+		callArgs = append(callArgs, inv.parameters)
+	}
+
+	return callWithBridge(ctx, std, inv.bridge, callArgs)
+}
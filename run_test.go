@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadInvocation(t *testing.T) {
+	for _, tt := range []struct {
+		file   string
+		more   bool
+		oneway bool
+		err    string
+	}{
+		{"method: a.b.C\naddress: unix:/x\n", false, false, ""},
+		{"method: a.b.C\naddress: unix:/x\nmore: true\n", true, false, ""},
+		{"method: a.b.C\naddress: unix:/x\noneway: 1\nmore: false\n", false, true, ""},
+		{"method: a.b.C\naddress: unix:/x\nmore: yes\n", false, false, "line 3: 'yes' is not true or false"},
+		{"method: a.b.C\naddress: unix:/x\noneway: True!\n", false, false, "line 3: 'True!' is not true or false"},
+	} {
+		path := filepath.Join(t.TempDir(), "call")
+		if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		inv, err := readInvocation(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: error %v, want %q", tt.file, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.file, err)
+			continue
+		}
+		if inv.more != tt.more || inv.oneway != tt.oneway {
+			t.Errorf("%q: more %v, oneway %v", tt.file, inv.more, inv.oneway)
+		}
+	}
+}
+
+func TestRunBridge(t *testing.T) {
+	defer func(b string) { bridge = b }(bridge)
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// The bridge of the file is used without touching -bridge.
+	viaBridge := write("bridge", "method: org.example.test.Echo\n"+
+		`bridge: printf '{"parameters":{"via":"bridge"}}\000'; cat >/dev/null`+"\n")
+	stdout, stderr, code := runCommand(t, "", "run", viaBridge)
+	if code != 0 || !strings.Contains(stdout, `"via": "bridge"`) {
+		t.Errorf("exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if bridge != "" {
+		t.Errorf("-bridge set to %q", bridge)
+	}
+
+	both := write("both", "method: org.example.test.Echo\naddress: unix:/x\nbridge: true\n")
+	if _, stderr, code := runCommand(t, "", "run", both); code != exitUsage || !strings.Contains(stderr, "both an address and a bridge") {
+		t.Errorf("address and bridge: exit code %d, stderr %q", code, stderr)
+	}
+
+	bridge = "true"
+	if _, stderr, code := runCommand(t, "", "run", viaBridge); code != exitUsage || !strings.Contains(stderr, "cannot be combined with run") {
+		t.Errorf("-bridge: exit code %d, stderr %q", code, stderr)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/varlink/go/varlink"
+)
+
+// servicesOptions are the options of services.
+type servicesOptions struct {
+	asJSON bool
+	help   bool
+}
+
+func (o *servicesOptions) flagSet() *flag.FlagSet {
+	servicesFlags := flag.NewFlagSet("services", flag.ContinueOnError)
+	servicesFlags.BoolVar(&o.asJSON, "json", false, "Print a JSON object mapping interface names to addresses")
+	servicesFlags.BoolVar(&o.help, "help", false, "Prints help information")
+	return servicesFlags
+}
+
+func varlinkServices(ctx context.Context, std *streams, args []string) error {
+	var o servicesOptions
+	servicesFlags := o.flagSet()
+	usage := func() error { return std.usage(servicesFlags, "") }
+	servicesFlags.SetOutput(std.err)
+	servicesFlags.Usage = func() {}
+
+	if err := servicesFlags.Parse(args); err != nil {
+		return usage()
+	}
+
+	if o.help || servicesFlags.NArg() != 0 {
+		return usage()
+	}
+
+	if noResolver {
+		return std.fail(exitFailure, "services needs the resolver, but -no-resolver is set\n")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, err := varlink.NewResolver(ctx, "")
+	if err != nil {
+		return std.fail(exitConnection, "Cannot connect to the varlink resolver at '%s', is it running? %v\n", varlink.ResolverAddress, err)
+	}
+	defer r.Close()
+
+	var interfaces []string
+	if err := r.GetInfo(ctx, nil, nil, nil, nil, &interfaces); err != nil {
+		if err := notVarlink(std, err, varlink.ResolverAddress); err != nil {
+			return err
+		}
+		return std.fail(exitFailure, "Cannot get the interfaces known to the resolver: %v\n", err)
+	}
+
+	addresses := &orderedObject{values: make(map[string]interface{})}
+	for _, iface := range interfaces {
+		address, err := r.Resolve(ctx, iface)
+		if err != nil {
+			return std.fail(exitFailure, "Cannot resolve interface '%s': %v\n", iface, err)
+		}
+		addresses.keys = append(addresses.keys, iface)
+		addresses.values[iface] = address
+	}
+
+	if o.asJSON {
+		c, _ := newFormatter().Marshal(addresses)
+		fmt.Fprintln(std.out, string(c))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(std.out, 0, 0, 2, ' ', 0)
+	for _, iface := range addresses.keys {
+		fmt.Fprintf(w, "%s\t%s\n", iface, addresses.values[iface])
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// pollConnect is how long to wait for the socket file of a unix:
+// address to appear before connecting, for services still starting up.
+var pollConnect time.Duration
+
+// waitForSocket waits until the socket file of a unix: address exists,
+// for at most -poll-connect. If it does not appear, connecting fails
+// as it would have without waiting.
+func waitForSocket(ctx context.Context, std *streams, address string) {
+	path, ok := strings.CutPrefix(address, "unix:")
+	if !ok || pollConnect <= 0 || strings.HasPrefix(path, "@") {
+		return
+	}
+	path = strings.SplitN(path, ";", 2)[0]
+
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pollConnect)
+	defer cancel()
+
+	std.trace("Waiting for %s", path)
+	if err := watchForFile(ctx, path); errors.Is(err, errors.ErrUnsupported) {
+		pollForFile(ctx, path)
+	}
+}
+
+// pollForFile checks for path until it exists or ctx is done.
+func pollForFile(ctx context.Context, path string) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// watchForFile waits with inotify until path exists or ctx is done.
+func watchForFile(ctx context.Context, path string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+	}
+	// A non-blocking file is handled by the runtime poller, which
+	// makes read deadlines work.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), syscall.IN_CREATE|syscall.IN_MOVED_TO); err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+	}
+
+	// Without a deadline, this waits for good.
+	deadline, _ := ctx.Deadline()
+	_ = f.SetReadDeadline(deadline)
+
+	buf := make([]byte, 4096)
+	for {
+		// The file may have been created before the watch was added.
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		if _, err := f.Read(buf); err != nil {
+			return nil
+		}
+	}
+}
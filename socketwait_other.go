@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// watchForFile is not supported without inotify.
+func watchForFile(ctx context.Context, path string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// stdinTimeout is the time to wait for the first input on stdin before
+// giving up, so that a command reading stdin does not wait silently on
+// a terminal when nothing was piped in.
+var stdinTimeout time.Duration
+
+var errNoStdin = errors.New("no input received on stdin")
+
+// stdinReader reads stdin, failing with errNoStdin if the first read
+// does not return within -stdin-timeout.
+type stdinReader struct {
+	in      io.Reader
+	started bool
+}
+
+func (r *stdinReader) Read(p []byte) (int, error) {
+	if r.started || stdinTimeout <= 0 {
+		return r.in.Read(p)
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := r.in.Read(p)
+		done <- result{n, err}
+	}()
+
+	select {
+	case res := <-done:
+		r.started = true
+		return res.n, res.err
+	case <-time.After(stdinTimeout):
+		// The read goes on in the background, so p must not be used
+		// again; the caller is expected to give up.
+		return 0, errNoStdin
+	}
+}
+
+// newStdinReader returns stdin for commands reading their input from it.
+func newStdinReader(std *streams) io.Reader {
+	return &stdinReader{in: std.in}
+}
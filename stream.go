@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+// streamHoldback is how much of the reply parameters streamCall holds
+// back before copying them out. An error reply fitting in it is
+// returned as *varlink.Error instead of being copied, like with -raw.
+const streamHoldback = 64 << 10
+
+var errMalformedReply = errors.New("malformed reply")
+
+// streamCall calls method over a connection of its own and copies the
+// parameters of the reply to w as they arrive, instead of reading the
+// reply completely like the varlink library does.
+func streamCall(ctx context.Context, std *streams, address string, method string, params json.RawMessage, w io.Writer) error {
+	network, addr, _ := strings.Cut(address, ":")
+	if network != "unix" && network != "tcp" {
+		return fmt.Errorf("-stream-output is not supported for '%s'", address)
+	}
+	addr = strings.SplitN(addr, ";", 2)[0]
+	if err := checkAbstractSocket(address); err != nil {
+		return err
+	}
+
+	var c net.Conn
+	err := retryConnect(ctx, std, address, func() (err error) {
+		c, err = dialConn(ctx, std, network, addr)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c = wrapConn(std, c)
+	defer c.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.SetDeadline(deadline)
+	}
+
+	request, err := json.Marshal(struct {
+		Method     string          `json:"method"`
+		Parameters json.RawMessage `json:"parameters,omitempty"`
+	}{method, params})
+	if err != nil {
+		return err
+	}
+	std.trace("Calling %s", method)
+	if _, err := c.Write(append(request, 0)); err != nil {
+		return err
+	}
+
+	return copyReply(bufio.NewReader(c), w)
+}
+
+// holdWriter holds back the first limit bytes written to it, then
+// passes everything on to w.
+type holdWriter struct {
+	w       io.Writer
+	limit   int
+	held    bytes.Buffer
+	flushed bool
+}
+
+func (h *holdWriter) Write(b []byte) (int, error) {
+	if h.flushed {
+		return h.w.Write(b)
+	}
+	h.held.Write(b)
+	if h.held.Len() > h.limit {
+		return len(b), h.flush()
+	}
+	return len(b), nil
+}
+
+func (h *holdWriter) flush() error {
+	h.flushed = true
+	_, err := h.w.Write(h.held.Bytes())
+	h.held.Reset()
+	return err
+}
+
+// copyReply reads a reply message from r and copies its parameters to
+// w, followed by a newline. A reply without parameters is copied as {}.
+func copyReply(r *bufio.Reader, w io.Writer) error {
+	hw := &holdWriter{w: w, limit: streamHoldback}
+	out := bufio.NewWriter(hw)
+	var errorName string
+	hasParameters := false
+
+	if b, err := nextByte(r); err != nil {
+		return err
+	} else if b != '{' {
+		return errMalformedReply
+	}
+	b, err := nextByte(r)
+	if err != nil {
+		return err
+	}
+	if b != '}' {
+		_ = r.UnreadByte()
+		for {
+			key, err := readKey(r)
+			if err != nil {
+				return err
+			}
+			switch key {
+			case "parameters":
+				hasParameters = true
+				err = copyValue(r, out)
+			case "error":
+				var value bytes.Buffer
+				if err = copyValue(r, &value); err == nil && json.Unmarshal(value.Bytes(), &errorName) != nil {
+					err = errMalformedReply
+				}
+			default:
+				err = copyValue(r, &bytes.Buffer{})
+			}
+			if err != nil {
+				return err
+			}
+
+			b, err = nextByte(r)
+			if err != nil {
+				return err
+			}
+			if b == '}' {
+				break
+			}
+			if b != ',' {
+				return errMalformedReply
+			}
+		}
+	}
+	if b, err := r.ReadByte(); err != nil {
+		return unexpectedEOF(err)
+	} else if b != 0 {
+		return errMalformedReply
+	}
+
+	if !hasParameters && errorName == "" {
+		_, _ = out.WriteString("{}")
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if errorName != "" {
+		e := &varlink.Error{Name: errorName, Parameters: (*json.RawMessage)(nil)}
+		if !hw.flushed {
+			if hasParameters {
+				raw := json.RawMessage(hw.held.Bytes())
+				e.Parameters = &raw
+			}
+			return e
+		}
+		// Too late, the parameters are copied out already.
+		_, _ = fmt.Fprintln(w)
+		return e
+	}
+	if err := hw.flush(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+// unexpectedEOF turns io.EOF in the middle of a message into
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// nextByte returns the next byte of r that is not JSON whitespace.
+func nextByte(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return b, nil
+		}
+	}
+}
+
+// readKey reads an object key from r, including the following colon.
+func readKey(r *bufio.Reader) (string, error) {
+	var quoted bytes.Buffer
+	if b, err := nextByte(r); err != nil {
+		return "", err
+	} else if b != '"' {
+		return "", errMalformedReply
+	}
+	_ = r.UnreadByte()
+	if err := copyValue(r, &quoted); err != nil {
+		return "", err
+	}
+	var key string
+	if err := json.Unmarshal(quoted.Bytes(), &key); err != nil {
+		return "", errMalformedReply
+	}
+	if b, err := nextByte(r); err != nil {
+		return "", err
+	} else if b != ':' {
+		return "", errMalformedReply
+	}
+	return key, nil
+}
+
+// copyValue copies the next JSON value of r to w without decoding it.
+// It only finds where the value ends; the value is not validated.
+func copyValue(r *bufio.Reader, w io.ByteWriter) error {
+	if _, err := nextByte(r); err != nil {
+		return err
+	}
+	_ = r.UnreadByte()
+
+	depth := 0
+	inString, escaped := false, false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if b == 0 {
+			// The message ends in the middle of the value.
+			return errMalformedReply
+		}
+
+		if inString {
+			if err := w.WriteByte(b); err != nil {
+				return err
+			}
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+				if depth == 0 {
+					return nil
+				}
+			}
+			continue
+		}
+
+		switch b {
+		case ',', '}', ']', ' ', '\t', '\r', '\n':
+			if depth == 0 {
+				// The end of a number or literal.
+				return r.UnreadByte()
+			}
+		}
+		if err := w.WriteByte(b); err != nil {
+			return err
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
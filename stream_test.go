@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStreamOutput(t *testing.T) {
+	address := startTestService(t)
+
+	stdout, stderr, code := runCommand(t, "", "call", "-raw", "-stream-output", address+"/org.example.test.Echo", `{"value":{"a":[1,"}"]}}`)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if want := `{"value":{"a":[1,"}"]}}` + "\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+
+	stdout, stderr, code = runCommand(t, "", "call", "-raw", "-stream-output", address+"/org.example.test.Fail")
+	if code != exitFailure {
+		t.Errorf("exit code %d, want %d", code, exitFailure)
+	}
+	if stdout != "" {
+		t.Errorf("error parameters on stdout: %q", stdout)
+	}
+	if !strings.Contains(stderr, "Call failed with error: org.example.test.NotHere") || !strings.Contains(stderr, `"code": 3`) {
+		t.Errorf("error not reported: %s", stderr)
+	}
+}
+
+func TestCopyReply(t *testing.T) {
+	for _, tc := range []struct {
+		reply, out, errName string
+		err                 error
+	}{
+		{`{"parameters":{"a":"x\"}"}}` + "\x00", `{"a":"x\"}"}` + "\n", "", nil},
+		{`{"continues":true, "parameters" : [1, 2] }` + "\x00", "[1, 2]\n", "", nil},
+		{"{}\x00", "{}\n", "", nil},
+		{`{"error":"org.example.Failed","parameters":{"code":1}}` + "\x00", "", "org.example.Failed", nil},
+		{`{"parameters":{"code":1},"error":"org.example.Failed"}` + "\x00", "", "org.example.Failed", nil},
+		{`{"parameters":{"a":1`, "", "", io.ErrUnexpectedEOF},
+		{`{"parameters":{"a":1` + "\x00", "", "", errMalformedReply},
+		{`["parameters"]` + "\x00", "", "", errMalformedReply},
+		{`{"parameters":{}}x`, "", "", errMalformedReply},
+	} {
+		var out bytes.Buffer
+		err := copyReply(bufio.NewReader(strings.NewReader(tc.reply)), &out)
+		if tc.errName != "" {
+			e, ok := varlinkError(err)
+			if !ok || e.Name != tc.errName {
+				t.Errorf("%q: got %v, want error %s", tc.reply, err, tc.errName)
+				continue
+			}
+			if p := e.Parameters.(*json.RawMessage); p == nil || string(*p) != `{"code":1}` {
+				t.Errorf("%q: wrong error parameters", tc.reply)
+			}
+		} else if err != tc.err {
+			t.Errorf("%q: got error %v, want %v", tc.reply, err, tc.err)
+		}
+		if out.String() != tc.out {
+			t.Errorf("%q: got %q, want %q", tc.reply, out.String(), tc.out)
+		}
+	}
+}
+
+// Parameters larger than streamHoldback are copied out before the
+// reply is complete.
+func TestCopyReplyStreams(t *testing.T) {
+	copied := make(chan struct{})
+	r, w := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(w, `{"parameters":{"data":"`+strings.Repeat("x", 2*streamHoldback))
+		// The rest only follows once the first part was copied out.
+		<-copied
+		_, _ = io.WriteString(w, `"}}`+"\x00")
+		w.Close()
+	}()
+
+	out := &notifyWriter{written: copied}
+	if err := copyReply(bufio.NewReader(r), out); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(out.String()); n != 2*streamHoldback+len(`{"data":""}`)+1 {
+		t.Errorf("got %d bytes", n)
+	}
+}
+
+// notifyWriter closes written on the first write.
+type notifyWriter struct {
+	bytes.Buffer
+	written chan struct{}
+	once    sync.Once
+}
+
+func (w *notifyWriter) Write(b []byte) (int, error) {
+	w.once.Do(func() { close(w.written) })
+	return w.Buffer.Write(b)
+}
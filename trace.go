@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	tracing     bool
+	traceStart  time.Time
+	debugFrames bool
+)
+
+// trace prints an event of the -trace timeline to stderr, stamped with
+// the time since the command started.
+func (std *streams) trace(format string, a ...interface{}) {
+	if !tracing {
+		return
+	}
+	elapsed := float64(time.Since(traceStart).Microseconds()) / 1000
+	fmt.Fprintf(std.err, "[%10.3fms] %s\n", elapsed, fmt.Sprintf(format, a...))
+}
+
+// traceConn adds the traffic on a connection to the -trace timeline.
+type traceConn struct {
+	net.Conn
+	std *streams
+
+	once sync.Once
+}
+
+func (c *traceConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.once.Do(func() { c.std.trace("First byte received") })
+		c.std.trace("Received %d bytes", n)
+	}
+	return n, err
+}
+
+func (c *traceConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.std.trace("Sent %d bytes", n)
+	return n, err
+}
+
+// frameConn prints each varlink message sent or received on a
+// connection, including its terminating NUL byte, for -debug-frames.
+type frameConn struct {
+	net.Conn
+	std *streams
+
+	mu       sync.Mutex
+	sent     []byte
+	received []byte
+}
+
+// secrets are replaced with *** in printed messages.
+var secrets [][]byte
+
+// hideSecret keeps s, like an authentication token, out of the messages
+// printed by -debug-frames.
+func hideSecret(s string) {
+	b, _ := json.Marshal(s)
+	if b = bytes.Trim(b, `"`); len(b) > 0 {
+		secrets = append(secrets, b)
+	}
+}
+
+// frames prints the complete messages in buf and returns the rest.
+func frames(w io.Writer, direction string, buf []byte) []byte {
+	for {
+		i := bytes.IndexByte(buf, 0)
+		if i == -1 {
+			return buf
+		}
+		message := buf[:i+1]
+		for _, secret := range secrets {
+			message = bytes.ReplaceAll(message, secret, []byte("***"))
+		}
+		fmt.Fprintf(w, "%s %q\n", direction, message)
+		buf = buf[i+1:]
+	}
+}
+
+func (c *frameConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.mu.Lock()
+	c.received = frames(c.std.err, "<-", append(c.received, b[:n]...))
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *frameConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.mu.Lock()
+	c.sent = frames(c.std.err, "->", append(c.sent, b[:n]...))
+	c.mu.Unlock()
+	return n, err
+}
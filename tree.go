@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// interfaceNode is one dot separated component of an interface name.
+type interfaceNode struct {
+	children map[string]*interfaceNode
+	iface    bool
+}
+
+// interfaceTree renders reverse-domain interface names as a tree
+// grouped by their common prefixes, one component per level. Chains of
+// components that only group a single child are joined on one line.
+func interfaceTree(interfaces []string, indent string) string {
+	root := &interfaceNode{children: make(map[string]*interfaceNode)}
+	for _, name := range interfaces {
+		n := root
+		for _, c := range strings.Split(name, ".") {
+			child, ok := n.children[c]
+			if !ok {
+				child = &interfaceNode{children: make(map[string]*interfaceNode)}
+				n.children[c] = child
+			}
+			n = child
+		}
+		n.iface = true
+	}
+
+	var b strings.Builder
+	root.write(&b, indent, indent)
+	return b.String()
+}
+
+func (n *interfaceNode) write(b *strings.Builder, prefix, indent string) {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := n.children[name]
+		for !child.iface && len(child.children) == 1 {
+			for c, grandchild := range child.children {
+				name += "." + c
+				child = grandchild
+			}
+		}
+
+		b.WriteString(prefix + name + "\n")
+		child.write(b, prefix+indent, indent)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+// Varlink has no version negotiation. Services that evolve an interface
+// incompatibly publish each version as its own interface, named after
+// the unversioned one with a ".v<N>" suffix, e.g. org.example.foo.v2.
+
+// versionedInterface returns the name of the given version of iface.
+func versionedInterface(iface, version string) string {
+	return iface + ".v" + strings.TrimPrefix(version, "v")
+}
+
+// calledInterface returns the interface called for iface with
+// -interface-version, which is iface itself if version is empty.
+func calledInterface(iface, version string) string {
+	if version == "" {
+		return iface
+	}
+	return versionedInterface(iface, version)
+}
+
+// calledMethod is calledInterface for the interface of method.
+func calledMethod(method, version string) string {
+	li := strings.LastIndex(method, ".")
+	if li == -1 {
+		return method
+	}
+	return calledInterface(method[:li], version) + method[li:]
+}
+
+// checkInterfaceVersion returns an error listing the offered versions
+// if the service does not provide the requested version of iface.
+func checkInterfaceVersion(ctx context.Context, con *varlink.Connection, iface, version string) error {
+	interfaces, err := serviceInterfaces(ctx, con)
+	if err != nil {
+		return err
+	}
+
+	want := versionedInterface(iface, version)
+	var offered []string
+	for _, i := range interfaces {
+		if i == want {
+			return nil
+		}
+		if v := strings.TrimPrefix(i, iface+".v"); v != i && !strings.Contains(v, ".") {
+			offered = append(offered, "v"+v)
+		}
+	}
+
+	if len(offered) == 0 {
+		return fmt.Errorf("service does not offer version %s of '%s'", version, iface)
+	}
+	return fmt.Errorf("service does not offer version %s of '%s', available: %s",
+		version, iface, strings.Join(offered, ", "))
+}
+
+// serviceInfo is the part of the service info used by the tool.
+type serviceInfo struct {
+	version    string
+	interfaces []string
+}
+
+// infoCache holds the info of the service behind each connection, so
+// that it is only asked for once per connection.
+var infoCache = make(map[*varlink.Connection]*serviceInfo)
+
+// getServiceInfo returns the info of the service behind con.
+func getServiceInfo(ctx context.Context, con *varlink.Connection) (*serviceInfo, error) {
+	if info, ok := infoCache[con]; ok {
+		return info, nil
+	}
+
+	var info serviceInfo
+	if err := con.GetInfo(ctx, nil, nil, &info.version, nil, &info.interfaces); err != nil {
+		return nil, err
+	}
+	infoCache[con] = &info
+	return &info, nil
+}
+
+// serviceInterfaces returns the interfaces the service provides.
+func serviceInterfaces(ctx context.Context, con *varlink.Connection) ([]string, error) {
+	info, err := getServiceInfo(ctx, con)
+	if err != nil {
+		return nil, err
+	}
+	return info.interfaces, nil
+}
+
+// checkInterface returns an error if the service does not provide
+// the interface of method.
+func checkInterface(ctx context.Context, con *varlink.Connection, method string) error {
+	li := strings.LastIndex(method, ".")
+	if li == -1 {
+		return fmt.Errorf("invalid method name '%s'", method)
+	}
+	iface := method[:li]
+
+	interfaces, err := serviceInterfaces(ctx, con)
+	if err != nil {
+		return err
+	}
+	for _, i := range interfaces {
+		if i == iface {
+			return nil
+		}
+	}
+	return fmt.Errorf("service does not provide interface '%s'", iface)
+}
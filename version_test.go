@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// -allow-interfaces applies to the versioned interface -interface-version
+// calls or describes, not to the name given.
+func TestInterfaceVersionAllowed(t *testing.T) {
+	address := startTestService(t)
+	defer func(v []string) { allowedInterfaces = v }(allowedInterfaces)
+
+	for _, args := range [][]string{
+		{"call", "-interface-version", "2", address + "/org.example.test.Echo", "{}"},
+		{"help", "-interface-version", "2", address + "/org.example.test"},
+	} {
+		allowedInterfaces = []string{"org.example.test"}
+		_, stderr, code := runCommand(t, "", args...)
+		if code != exitUsage || !strings.Contains(stderr, "Interface 'org.example.test.v2' is not allowed") {
+			t.Errorf("%s with org.example.test allowed: exit code %d, stderr %q", args[0], code, stderr)
+		}
+
+		allowedInterfaces = []string{"org.example.test.v2"}
+		_, stderr, code = runCommand(t, "", args...)
+		if code != exitFailure || !strings.Contains(stderr, "service does not offer version 2 of 'org.example.test'") {
+			t.Errorf("%s with org.example.test.v2 allowed: exit code %d, stderr %q", args[0], code, stderr)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+// connectVia is a command speaking varlink on its standard input and
+// output, like a bridge, e.g. "kubectl exec -i pod -- varlink bridge".
+// It stands in for -bridge in all commands.
+var connectVia string
+
+// viaProcess is the running -connect-via command.
+type viaProcess struct {
+	cmd    *exec.Cmd
+	stderr *viaStderr
+	// err is the result of the command, set before exited is closed.
+	err    error
+	exited chan struct{}
+	// closing is set once the tool hangs up, after which the command
+	// is expected to exit.
+	closing atomic.Bool
+}
+
+var via *viaProcess
+
+// viaStderr keeps the end of what the -connect-via command wrote to
+// stderr, to explain its failure.
+type viaStderr struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+const viaStderrSize = 4096
+
+func (s *viaStderr) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(b)
+	if n := s.buf.Len() - viaStderrSize; n > 0 {
+		s.buf.Next(n)
+	}
+	return len(b), nil
+}
+
+func (s *viaStderr) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+// connectCommand starts the -connect-via command and returns a
+// connection over its standard input and output. The command is killed
+// when ctx is done. If it exits before the tool hangs up, reportCommand
+// prints its status and stderr.
+func connectCommand(ctx context.Context, std *streams) (*varlink.Connection, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", connectVia)
+	cmdStdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmdStdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmdStderr := &viaStderr{}
+	if debug {
+		cmd.Stderr = io.MultiWriter(std.err, cmdStderr)
+	} else {
+		cmd.Stderr = cmdStderr
+	}
+	p := &viaProcess{cmd: cmd, stderr: cmdStderr, exited: make(chan struct{})}
+	cmd.Cancel = func() error {
+		// Killing the command is hanging up, not a failure to report.
+		p.closing.Store(true)
+		return cmd.Process.Kill()
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	a, b := net.Pipe()
+	go func() {
+		_, _ = io.Copy(cmdStdin, b)
+		cmdStdin.Close()
+	}()
+	go func() {
+		_, _ = io.Copy(b, cmdStdout)
+		p.err = cmd.Wait()
+		if p.err == nil {
+			p.err = errors.New("exit status 0")
+		}
+		close(p.exited)
+		// Only now the connection sees the command is gone.
+		b.Close()
+	}()
+
+	con, err := connectConn(ctx, a)
+	if err != nil {
+		p.closing.Store(true)
+		_ = cmd.Process.Kill()
+		return nil, err
+	}
+	via = p
+	return con, nil
+}
+
+// reportCommand prints why the -connect-via command exited, if it did
+// so before the tool hung up.
+func reportCommand(std *streams) {
+	if via == nil || via.closing.Load() {
+		return
+	}
+	select {
+	case <-via.exited:
+	default:
+		return
+	}
+	fmt.Fprintf(std.err, "Command '%s' exited: %v\n", connectVia, via.err)
+	fmt.Fprint(std.err, via.stderr.String())
+}
+
+// stopCommand waits a moment for the -connect-via command to exit
+// after the tool hung up, then kills it.
+func stopCommand() {
+	if via == nil {
+		return
+	}
+	select {
+	case <-via.exited:
+	case <-time.After(time.Second):
+		_ = via.cmd.Process.Kill()
+	}
+	via = nil
+}
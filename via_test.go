@@ -0,0 +1,52 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// A -connect-via command that never answers is killed when the
+// context of the command is done.
+func TestConnectViaCancel(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	defer func(b, c string) { bridge, connectVia = b, c }(bridge, connectVia)
+	connectVia = "echo $$ > " + pidFile + "; exec sleep 30"
+	bridge = connectVia
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	std := &streams{in: strings.NewReader(""), out: &stdout, err: &stderr}
+	start := time.Now()
+	err := run(ctx, std, []string{"call", "org.example.test.Echo", "{}"})
+	if err == nil {
+		t.Errorf("call succeeded, stdout %q", stdout.String())
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("call returned after %v", d)
+	}
+	if strings.Contains(stderr.String(), "exited") {
+		t.Errorf("stderr %q reports the killed command", stderr.String())
+	}
+
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(pid, 0); err != syscall.ESRCH {
+		t.Errorf("command %d still running: %v", pid, err)
+	}
+}
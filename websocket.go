@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes, RFC 6455 section 5.2.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// wsGUID is appended to the key of the opening handshake to compute
+// the accept header of the server.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// isWebSocket reports whether address is a ws:// or wss:// URL.
+func isWebSocket(address string) bool {
+	return strings.HasPrefix(address, "ws://") || strings.HasPrefix(address, "wss://")
+}
+
+// checkScheme fails for URL-like addresses other than WebSocket ones.
+// Varlink addresses have no "//" after the protocol, so e.g.
+// http://host is a mistake rather than a path.
+func checkScheme(address string) error {
+	scheme, _, ok := strings.Cut(address, "://")
+	if !ok || isWebSocket(address) || strings.ContainsAny(scheme, "/;") {
+		return nil
+	}
+	return fmt.Errorf("unsupported address scheme '%s://', use ws:// or wss:// for WebSocket", scheme)
+}
+
+// dialWebSocket opens a WebSocket connection to the ws:// or wss://
+// URL address. The returned conn carries the payload of the messages,
+// which is where the varlink messages go.
+func dialWebSocket(ctx context.Context, address string) (net.Conn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	d := net.Dialer{KeepAlive: keepAlive}
+	c, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "wss" {
+		tc := tls.Client(c, &tls.Config{ServerName: u.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c = tc
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.SetDeadline(deadline)
+	}
+	r, err := wsHandshake(c, u)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	_ = c.SetDeadline(time.Time{})
+
+	return &wsConn{Conn: c, r: r}, nil
+}
+
+// wsHandshake sends the opening handshake for u on c and checks the
+// answer of the server.
+func wsHandshake(c net.Conn, u *url.URL) (*bufio.Reader, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Scheme: "http", Host: u.Host, Path: u.Path, RawQuery: u.RawQuery},
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	}
+	if err := req.Write(c); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(c)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("WebSocket handshake failed: %s", resp.Status)
+	}
+
+	h := sha1.Sum([]byte(key + wsGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(h[:]) {
+		return nil, fmt.Errorf("WebSocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+	return r, nil
+}
+
+// wsConn reads and writes the payload of WebSocket messages. Each
+// Write is sent as one binary message; the payload of the received
+// data messages is read as one stream, since varlink messages carry
+// their own NUL terminator.
+type wsConn struct {
+	net.Conn
+
+	r         *bufio.Reader
+	remaining uint64
+	mask      []byte
+	maskPos   int
+
+	mu     sync.Mutex
+	closed bool // a close frame was sent
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		opcode, length, mask, err := c.readHeader()
+		if err != nil {
+			return 0, err
+		}
+
+		switch opcode {
+		case wsContinuation, wsText, wsBinary:
+			c.remaining, c.mask, c.maskPos = length, mask, 0
+		case wsClose:
+			_ = c.writeFrame(wsClose, nil)
+			return 0, io.EOF
+		case wsPing, wsPong:
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(c.r, payload); err != nil {
+				return 0, err
+			}
+			if opcode == wsPing {
+				if mask != nil {
+					for i := range payload {
+						payload[i] ^= mask[i%4]
+					}
+				}
+				if err := c.writeFrame(wsPong, payload); err != nil {
+					return 0, err
+				}
+			}
+		default:
+			return 0, fmt.Errorf("unknown WebSocket opcode %#x", opcode)
+		}
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.r.Read(b)
+	if c.mask != nil {
+		for i := range b[:n] {
+			b[i] ^= c.mask[c.maskPos%4]
+			c.maskPos++
+		}
+	}
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// readHeader reads the header of the next frame.
+func (c *wsConn) readHeader() (opcode byte, length uint64, mask []byte, err error) {
+	var h [2]byte
+	if _, err := io.ReadFull(c.r, h[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	opcode = h[0] & 0x0f
+
+	length = uint64(h[1] & 0x7f)
+	switch length {
+	case 126:
+		var l [2]byte
+		if _, err := io.ReadFull(c.r, l[:]); err != nil {
+			return 0, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(l[:]))
+	case 127:
+		var l [8]byte
+		if _, err := io.ReadFull(c.r, l[:]); err != nil {
+			return 0, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(l[:])
+	}
+
+	if h[1]&0x80 != 0 {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.r, mask); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	return opcode, length, mask, nil
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(wsBinary, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeFrame sends payload as a single masked frame, as clients must.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch l := len(payload); {
+	case l < 126:
+		frame = append(frame, 0x80|byte(l))
+	case l <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(l))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(l))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, p := range payload {
+		frame = append(frame, p^mask[i%4])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		// Nothing may follow a close frame, RFC 6455 section 5.5.1.
+		if opcode == wsClose {
+			return nil
+		}
+		return net.ErrClosed
+	}
+	c.closed = opcode == wsClose
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+func (c *wsConn) Close() error {
+	_ = c.writeFrame(wsClose, nil)
+	return c.Conn.Close()
+}
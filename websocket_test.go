@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wsServer is the server end of a WebSocket connection.
+type wsServer struct {
+	c net.Conn
+	r *bufio.Reader
+}
+
+// wsAccept returns the Sec-WebSocket-Accept header for key.
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// serveWebSocket serves WebSocket connections until the test ends,
+// answering the opening handshake with accept(key) and then handing
+// the connection to serve. It returns the ws:// URL of the server.
+func serveWebSocket(t *testing.T, accept func(key string) string, serve func(ws *wsServer)) string {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Sec-WebSocket-Key")
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+			http.Error(w, "not a WebSocket handshake", http.StatusBadRequest)
+			return
+		}
+		c, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept(key))
+		if err := rw.Flush(); err != nil {
+			return
+		}
+		serve(&wsServer{c: c, r: rw.Reader})
+	}))
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// readFrame reads the next frame of the client, which has to be masked.
+func (ws *wsServer) readFrame() (byte, []byte, error) {
+	opcode, length, mask, err := (&wsConn{r: ws.r}).readHeader()
+	if err != nil {
+		return 0, nil, err
+	}
+	if mask == nil {
+		return 0, nil, fmt.Errorf("unmasked frame from the client")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// readMessage reads data frames up to the end of a varlink message.
+func (ws *wsServer) readMessage() (string, error) {
+	var msg bytes.Buffer
+	for !bytes.HasSuffix(msg.Bytes(), []byte{0}) {
+		opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return "", err
+		}
+		if opcode != wsBinary && opcode != wsText && opcode != wsContinuation {
+			return "", fmt.Errorf("unexpected opcode %#x", opcode)
+		}
+		msg.Write(payload)
+	}
+	return msg.String(), nil
+}
+
+// writeFrame sends an unmasked frame, as servers do.
+func (ws *wsServer) writeFrame(fin bool, opcode byte, payload []byte) error {
+	b := opcode
+	if fin {
+		b |= 0x80
+	}
+	frame := []byte{b}
+	if l := len(payload); l < 126 {
+		frame = append(frame, byte(l))
+	} else {
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(l))
+	}
+	_, err := ws.c.Write(append(frame, payload...))
+	return err
+}
+
+// relay passes the messages of the client on to the varlink service at
+// address and its replies back, one frame per read.
+func (ws *wsServer) relay(address string) error {
+	network, addr, _ := strings.Cut(address, ":")
+	service, err := net.Dial(network, addr)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	go func() {
+		b := make([]byte, 4096)
+		for {
+			n, err := service.Read(b)
+			if n > 0 && ws.writeFrame(true, wsBinary, b[:n]) != nil {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case wsClose:
+			return ws.writeFrame(true, wsClose, nil)
+		case wsBinary, wsText, wsContinuation:
+			if _, err := service.Write(payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func TestWebSocketCall(t *testing.T) {
+	service := startTestService(t)
+	address := serveWebSocket(t, wsAccept, func(ws *wsServer) {
+		_ = ws.relay(service)
+	})
+
+	stdout, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Echo", `{"value":{"a":1}}`)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"a": 1`) {
+		t.Errorf("unexpected reply %q", stdout)
+	}
+}
+
+// A reply may be split across a data frame and its continuations, with
+// a ping in between to be answered.
+func TestWebSocketFragments(t *testing.T) {
+	pong := make(chan string, 1)
+	address := serveWebSocket(t, wsAccept, func(ws *wsServer) {
+		if _, err := ws.readMessage(); err != nil {
+			t.Error(err)
+			return
+		}
+		_ = ws.writeFrame(false, wsText, []byte(`{"param`))
+		_ = ws.writeFrame(true, wsPing, []byte("are you there"))
+		_ = ws.writeFrame(false, wsContinuation, []byte(`eters":{"n":`))
+		_ = ws.writeFrame(true, wsContinuation, []byte("42}}\x00"))
+
+		opcode, payload, err := ws.readFrame()
+		if err != nil || opcode != wsPong {
+			t.Errorf("no pong: opcode %#x, %v", opcode, err)
+			return
+		}
+		pong <- string(payload)
+	})
+
+	stdout, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Count", `{"count":1}`)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"n": 42`) {
+		t.Errorf("unexpected reply %q", stdout)
+	}
+	if got := <-pong; got != "are you there" {
+		t.Errorf("pong %q, want the payload of the ping", got)
+	}
+}
+
+// The client answers a close of the server with a single close frame.
+func TestWebSocketServerClose(t *testing.T) {
+	closes := make(chan int, 1)
+	address := serveWebSocket(t, wsAccept, func(ws *wsServer) {
+		if _, err := ws.readMessage(); err != nil {
+			t.Error(err)
+			return
+		}
+		_ = ws.writeFrame(true, wsClose, nil)
+
+		n := 0
+		for {
+			opcode, _, err := ws.readFrame()
+			if err != nil {
+				break
+			}
+			if opcode == wsClose {
+				n++
+			}
+		}
+		closes <- n
+	})
+
+	_, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Echo", "{}")
+	if code != exitConnection || !strings.Contains(stderr, "Server closed connection") {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+	if n := <-closes; n != 1 {
+		t.Errorf("client sent %d close frames, want 1", n)
+	}
+}
+
+func TestWebSocketBadAccept(t *testing.T) {
+	address := serveWebSocket(t, func(string) string { return wsAccept("wrong") }, func(ws *wsServer) {
+		_, _ = io.Copy(io.Discard, ws.r)
+	})
+
+	_, stderr, code := runCommand(t, "", "call", address+"/org.example.test.Echo", "{}")
+	if code != exitConnection || !strings.Contains(stderr, "invalid Sec-WebSocket-Accept") {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+}